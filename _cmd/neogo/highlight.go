@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/myitcv/neogo"
+)
+
+// ANSI colours for each highlight class in -format ansi output
+var ansiColours = map[string]string{
+	"Keyword":     "\x1b[1;33m",
+	"Statement":   "\x1b[33m",
+	"Conditional": "\x1b[33m",
+	"Repeat":      "\x1b[33m",
+	"Label":       "\x1b[33m",
+	"String":      "\x1b[31m",
+	"Type":        "\x1b[32m",
+	"Function":    "\x1b[36m",
+	"Comment":     "\x1b[34m",
+}
+
+const ansiReset = "\x1b[0m"
+
+// runHighlight implements
+//
+//	neogo highlight [-format json|ansi] file.go
+//
+// printing the spans neogo would highlight in file.go ("-" for stdin)
+func runHighlight(args []string) int {
+	fs := flag.NewFlagSet("highlight", flag.ContinueOnError)
+	format := fs.String("format", "json", "output format: json (one span per line) or ansi (coloured source)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %v highlight [-format json|ansi] file.go\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 || (*format != "json" && *format != "ansi") {
+		fs.Usage()
+		return exitUsage
+	}
+
+	fn := fs.Arg(0)
+	var src []byte
+	var err error
+	if fn == "-" {
+		src, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		src, err = ioutil.ReadFile(fn)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return exitError
+	}
+
+	spans, err := neogo.Highlight(fn, src)
+	if err != nil {
+		// like the plugin we highlight what we can; the errors are
+		// useful context in a bug report
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		if spans == nil {
+			return exitError
+		}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	switch *format {
+	case "json":
+		err = writeJSON(w, spans)
+	case "ansi":
+		err = writeANSI(w, src, spans)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func writeJSON(w io.Writer, spans []neogo.Span) error {
+	enc := json.NewEncoder(w)
+	for _, s := range spans {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeANSI writes src with each span coloured. spans must be in file order;
+// a span that overlaps an earlier one is dropped.
+func writeANSI(w io.Writer, src []byte, spans []neogo.Span) error {
+	lines := strings.Split(string(src), "\n")
+	for i, l := range lines {
+		line := i + 1
+		col := 0
+		for len(spans) > 0 && spans[0].Line <= line {
+			s := spans[0]
+			spans = spans[1:]
+
+			start := s.Col - 1
+			if s.Line < line || start < col || start >= len(l) {
+				continue
+			}
+			end := start + s.Len
+			if end > len(l) {
+				// multi-line comments and raw strings; colour what is
+				// on this line
+				end = len(l)
+			}
+			fmt.Fprintf(w, "%v%v%v%v", l[col:start], ansiColours[s.Class], l[start:end], ansiReset)
+			col = end
+		}
+		if _, err := fmt.Fprintf(w, "%v", l[col:]); err != nil {
+			return err
+		}
+		if i < len(lines)-1 {
+			fmt.Fprintln(w)
+		}
+	}
+	return nil
+}
@@ -1,22 +1,178 @@
+// neogo runs the neogo plugin as a standalone process, either connected to a
+// running Neovim over its listen socket or started by Neovim as an RPC job
+// talking msgpack-rpc over stdin/stdout:
+//
+//	call jobstart(['neogo', '-stdio'], {'rpc': v:true})
+//
+// Flags provide the base configuration; g:neogo_* variables set in Neovim
+// take precedence over them.
+//
+// neogo highlight runs the highlighting pipeline over a file without Neovim
+// and prints every span, either as JSON or as ANSI-coloured source:
+//
+//	neogo highlight [-format json|ansi] file.go
 package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"net"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/juju/errgo"
+	"github.com/myitcv/neogo"
 	"github.com/myitcv/neovim"
 )
 
-var fDebug = flag.Bool("debug", false, "enable debug logging")
-var fDebugAST = flag.Bool("debugAST", false, "enable print of AST")
+var (
+	fAddr          = flag.String("addr", listenAddress(), "Neovim listen socket to connect to")
+	fStdio         = flag.Bool("stdio", false, "talk msgpack-rpc over stdin/stdout, for use as an rpc job")
+	fDebug         = flag.Bool("debug", false, "enable debug logging")
+	fDebugAST      = flag.Bool("debugAST", false, "enable print of AST")
+	fLogLevel      = flag.String("logLevel", "", "log level: error, info or debug")
+	fFeatures      = flag.String("features", "", "comma-separated list of enabled features (default all)")
+	fDebounce      = flag.Duration("debounce", neogo.DefaultConfig().Debounce, "delay after a buffer change before re-parsing")
+	fMaxFileSize   = flag.Int("maxFileSize", neogo.DefaultConfig().MaxFileSize, "size in bytes above which buffers are not highlighted; 0 for no limit")
+	fSemantic      = flag.Bool("semantic", false, "turn off regex-based syntax in buffers neogo highlights")
+	fFmtOnSave     = flag.Bool("fmtOnSave", false, "gofmt buffers before they are written")
+	fImportsOnSave = flag.Bool("importsOnSave", false, "organize the imports of buffers before they are written")
+	fLocalPrefix   = flag.String("localPrefix", "", "comma-separated import path prefixes grouped after third party imports (default the module path)")
+	fTagTransform  = flag.String("tagTransform", neogo.DefaultConfig().TagTransform, "how :NeogoAddTags derives tag values from field names: snakecase or camelcase")
+)
+
+const (
+	exitOK = iota
+	exitError
+	exitUsage
+)
+
+func listenAddress() string {
+	if a := os.Getenv("NVIM_LISTEN_ADDRESS"); a != "" {
+		return a
+	}
+	return os.Getenv("NEOVIM_LISTEN_ADDRESS")
+}
 
 func main() {
-	c, err := neovim.NewUnixClient("unix", nil, &net.UnixAddr{Name: os.Getenv("NEOVIM_LISTEN_ADDRESS")})
+	flag.Usage = usage
+	flag.Parse()
+
+	os.Exit(run())
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %v [flags]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %v highlight [-format json|ansi] file.go\n\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func run() int {
+	if flag.NArg() != 0 {
+		if flag.Arg(0) == "highlight" {
+			return runHighlight(flag.Args()[1:])
+		}
+		usage()
+		return exitUsage
+	}
+
+	cfg, err := flagConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return exitUsage
+	}
+
+	// with -stdio, stdout belongs to msgpack-rpc, so we always log to stderr
+	l := log.New(os.Stderr, "neogo: ", log.LstdFlags)
+
+	var c *neovim.Client
+	switch {
+	case *fStdio:
+		c, err = neovim.NewStdioClient(neovim.NullInitMethod, l)
+	case *fAddr != "":
+		c, err = neovim.NewUnixClient(neovim.NullInitMethod, "unix", nil, &net.UnixAddr{Name: *fAddr}, l)
+	default:
+		fmt.Fprintf(os.Stderr, "need one of -stdio or -addr (or NVIM_LISTEN_ADDRESS)\n")
+		return exitUsage
+	}
 	if err != nil {
-		log.Fatalf("Could not setup client: %v", errgo.Details(err))
+		l.Printf("Could not setup client: %v", errgo.Details(err))
+		return exitError
+	}
+
+	n := &neogo.Neogo{Base: &cfg}
+	if err := n.Init(c, l); err != nil {
+		l.Printf("Could not Init plugin: %v", err)
+		c.Close()
+		return exitError
 	}
-	c.PanicOnError = true
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	res := exitOK
+	select {
+	case <-c.KillChannel:
+		// Neovim went away
+	case s := <-sigs:
+		l.Printf("exiting on %v", s)
+	}
+
+	if err := n.Shutdown(); err != nil {
+		l.Printf("Could not Shutdown plugin: %v", err)
+		res = exitError
+	}
+	// the connection is expected to be gone already if Neovim exited, so
+	// there is nothing useful to do with an error here
+	c.Close()
+
+	return res
+}
+
+func flagConfig() (neogo.Config, error) {
+	cfg := neogo.DefaultConfig()
+
+	cfg.Debounce = *fDebounce
+	if cfg.Debounce < 0 {
+		return cfg, fmt.Errorf("-debounce must not be negative")
+	}
+
+	cfg.MaxFileSize = *fMaxFileSize
+	if cfg.MaxFileSize < 0 {
+		return cfg, fmt.Errorf("-maxFileSize must not be negative")
+	}
+
+	cfg.Semantic = *fSemantic
+	cfg.FmtOnSave = *fFmtOnSave
+	cfg.ImportsOnSave = *fImportsOnSave
+	cfg.LocalPrefix = *fLocalPrefix
+	cfg.TagTransform = *fTagTransform
+	cfg.DebugAST = *fDebugAST
+
+	if *fDebug {
+		cfg.LogLevel = neogo.LogDebug
+	}
+	if *fLogLevel != "" {
+		l, err := neogo.ParseLogLevel(*fLogLevel)
+		if err != nil {
+			return cfg, fmt.Errorf("-logLevel: %v", err)
+		}
+		cfg.LogLevel = l
+	}
+
+	if *fFeatures != "" {
+		cfg.Features = make(map[string]bool)
+		for _, f := range strings.Split(*fFeatures, ",") {
+			f = strings.TrimSpace(f)
+			if !neogo.KnownFeature(f) {
+				return cfg, fmt.Errorf("-features: unknown feature %q", f)
+			}
+			cfg.Features[f] = true
+		}
+	}
+
+	return cfg, nil
 }
@@ -0,0 +1,13 @@
+package golden
+
+import "fmt"
+
+func broken( {
+	fmt.Println("still highlighted")
+	if x := 1; x > {
+	}
+}
+
+func afterwards() string {
+	return "ok"
+}
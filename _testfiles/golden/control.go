@@ -0,0 +1,36 @@
+package golden
+
+func control(xs []int, ch chan int) (res int) {
+	for i := 0; i < len(xs); i++ {
+		if xs[i] > 0 {
+			continue
+		} else if xs[i] < 0 {
+			break
+		}
+	}
+
+	for i, x := range xs {
+		res += i * x
+	}
+
+	for range xs {
+	}
+
+	switch res {
+	case 0:
+		res = 1
+	default:
+		goto end
+	}
+
+	select {
+	case v := <-ch:
+		res = v
+	}
+
+	defer func() {}()
+	go func() {}()
+
+end:
+	return res
+}
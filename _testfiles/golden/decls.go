@@ -0,0 +1,30 @@
+package golden
+
+const answer = 42
+
+const (
+	a = "a"
+	b = `b`
+)
+
+var x, y int
+
+var (
+	m map[string]chan int
+	f func(int) error
+)
+
+type T struct {
+	Name string
+	next *T
+}
+
+type I interface {
+	Method(x int) (string, error)
+}
+
+func (t *T) String() string {
+	return t.Name
+}
+
+func Free(a, b int, c map[int]string) {}
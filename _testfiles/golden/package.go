@@ -0,0 +1,14 @@
+// Package golden is a minimal file
+package golden
+
+import "fmt"
+
+import (
+	"os"
+	"strings"
+)
+
+/* a block
+   comment */
+
+var _ = fmt.Sprint(os.Args, strings.Join)
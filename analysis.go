@@ -0,0 +1,173 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/assign"
+	"golang.org/x/tools/go/analysis/passes/composite"
+	"golang.org/x/tools/go/analysis/passes/hostport"
+	"golang.org/x/tools/go/analysis/passes/printf"
+	"golang.org/x/tools/go/analysis/passes/sigchanyzer"
+	"golang.org/x/tools/go/analysis/passes/stringintconv"
+	"golang.org/x/tools/go/analysis/passes/timeformat"
+	"golang.org/x/tools/go/analysis/passes/unreachable"
+)
+
+// analyzers are the analyzers whose suggested fixes :NeogoCodeAction offers
+var analyzers = []*analysis.Analyzer{
+	assign.Analyzer,
+	composite.Analyzer,
+	hostport.Analyzer,
+	printf.Analyzer,
+	sigchanyzer.Analyzer,
+	stringintconv.Analyzer,
+	timeformat.Analyzer,
+	unreachable.Analyzer,
+}
+
+// diagnostic is a diagnostic reported by the analyzer named
+type diagnostic struct {
+	analyzer string
+	analysis.Diagnostic
+}
+
+// factKey identifies a fact exported by an analyzer, about obj or, if obj is
+// nil, the package
+type factKey struct {
+	analyzer *analysis.Analyzer
+	obj      types.Object
+	typ      reflect.Type
+}
+
+// analyze runs as, and the analyzers they require, on p, returning what
+// as report. Those that cannot run despite errors are skipped if p has
+// any. Facts are only shared within p: none are imported from the packages
+// it depends on, so analyzers that rely on them see less. One that fails
+// does not stop the others; the errors of all that fail are returned with
+// what the rest report
+func analyze(fset *token.FileSet, p *pkgInfo, sizes types.Sizes, as []*analysis.Analyzer) ([]diagnostic, error) {
+	var typeErrs []types.Error
+	for _, err := range p.errs {
+		if te, ok := err.(types.Error); ok {
+			typeErrs = append(typeErrs, te)
+		}
+	}
+
+	var res []diagnostic
+	report := make(map[*analysis.Analyzer]bool)
+	for _, a := range as {
+		report[a] = true
+	}
+	facts := make(map[factKey]analysis.Fact)
+	results := make(map[*analysis.Analyzer]interface{})
+	ran := make(map[*analysis.Analyzer]bool)
+
+	var run func(a *analysis.Analyzer) (bool, error)
+	run = func(a *analysis.Analyzer) (bool, error) {
+		if done, ok := ran[a]; ok {
+			return done, nil
+		}
+		ran[a] = false
+		if len(p.errs) > 0 && !a.RunDespiteErrors {
+			return false, nil
+		}
+		deps := make(map[*analysis.Analyzer]interface{})
+		for _, req := range a.Requires {
+			ok, err := run(req)
+			if err != nil || !ok {
+				return false, err
+			}
+			deps[req] = results[req]
+		}
+
+		get := func(obj types.Object, fact analysis.Fact) bool {
+			f, ok := facts[factKey{a, obj, reflect.TypeOf(fact)}]
+			if ok {
+				reflect.ValueOf(fact).Elem().Set(reflect.ValueOf(f).Elem())
+			}
+			return ok
+		}
+		pass := &analysis.Pass{
+			Analyzer:   a,
+			Fset:       fset,
+			Files:      p.files,
+			Pkg:        p.pkg,
+			TypesInfo:  p.info,
+			TypesSizes: sizes,
+			TypeErrors: typeErrs,
+			ResultOf:   deps,
+			ReadFile:   ioutil.ReadFile,
+			Report: func(d analysis.Diagnostic) {
+				if report[a] {
+					res = append(res, diagnostic{analyzer: a.Name, Diagnostic: d})
+				}
+			},
+			ImportObjectFact: func(obj types.Object, fact analysis.Fact) bool {
+				return obj != nil && obj.Pkg() == p.pkg && get(obj, fact)
+			},
+			ImportPackageFact: func(pkg *types.Package, fact analysis.Fact) bool {
+				return pkg == p.pkg && get(nil, fact)
+			},
+			ExportObjectFact: func(obj types.Object, fact analysis.Fact) {
+				facts[factKey{a, obj, reflect.TypeOf(fact)}] = fact
+			},
+			ExportPackageFact: func(fact analysis.Fact) {
+				facts[factKey{a, nil, reflect.TypeOf(fact)}] = fact
+			},
+			AllObjectFacts: func() []analysis.ObjectFact {
+				var res []analysis.ObjectFact
+				for k, f := range facts {
+					if k.analyzer == a && k.obj != nil {
+						res = append(res, analysis.ObjectFact{Object: k.obj, Fact: f})
+					}
+				}
+				return res
+			},
+			AllPackageFacts: func() []analysis.PackageFact {
+				var res []analysis.PackageFact
+				for k, f := range facts {
+					if k.analyzer == a && k.obj == nil {
+						res = append(res, analysis.PackageFact{Package: p.pkg, Fact: f})
+					}
+				}
+				return res
+			},
+		}
+		r, err := a.Run(pass)
+		if err != nil {
+			return false, fmt.Errorf("%v: %v", a.Name, err)
+		}
+		results[a] = r
+		ran[a] = true
+		return true, nil
+	}
+
+	var errs []string
+	for _, a := range as {
+		if _, err := run(a); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	sort.Stable(byDiagnosticPos(res))
+	if errs != nil {
+		return res, fmt.Errorf("%v", strings.Join(errs, "; "))
+	}
+	return res, nil
+}
+
+type byDiagnosticPos []diagnostic
+
+func (d byDiagnosticPos) Len() int           { return len(d) }
+func (d byDiagnosticPos) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d byDiagnosticPos) Less(i, j int) bool { return d[i].Pos < d[j].Pos }
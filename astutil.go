@@ -0,0 +1,129 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// enclosing returns the nodes of f that contain pos, innermost first
+func enclosing(f *ast.File, pos token.Pos) []ast.Node {
+	var res []ast.Node
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		if pos < n.Pos() || pos >= n.End() {
+			return false
+		}
+		res = append(res, n)
+		return true
+	})
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
+
+// identAt returns the identifier in f at pos, or nil
+func identAt(f *ast.File, pos token.Pos) *ast.Ident {
+	for _, n := range enclosing(f, pos) {
+		if id, ok := n.(*ast.Ident); ok {
+			return id
+		}
+	}
+	return nil
+}
+
+// filePos converts a byte offset in f to a token.Pos
+func filePos(fset *token.FileSet, f *ast.File, off int) token.Pos {
+	tf := fset.File(f.Pos())
+	if off < 0 {
+		off = 0
+	}
+	if off > tf.Size() {
+		off = tf.Size()
+	}
+	return tf.Pos(off)
+}
+
+// objectAt returns the identifier at pos and the object it denotes
+func objectAt(p *pkgInfo, f *ast.File, pos token.Pos) (*ast.Ident, types.Object) {
+	id := identAt(f, pos)
+	if id == nil {
+		return nil, nil
+	}
+	if obj := p.info.Uses[id]; obj != nil {
+		return id, obj
+	}
+	if obj := p.info.Defs[id]; obj != nil {
+		return id, obj
+	}
+	return id, nil
+}
+
+// objKey identifies an object across separately checked variants of a package
+// (e.g. the package and the package with its tests), where the same source
+// declaration yields distinct types.Objects
+type objKey struct {
+	name string
+	pos  token.Position
+}
+
+func keyOf(fset *token.FileSet, obj types.Object) objKey {
+	obj = origin(obj)
+	p := fset.Position(obj.Pos())
+	// the column is implied by the offset
+	p.Line, p.Column = 0, 0
+	return objKey{name: obj.Name(), pos: p}
+}
+
+// origin returns the generic object from which obj was instantiated, or obj
+func origin(obj types.Object) types.Object {
+	switch o := obj.(type) {
+	case *types.Var:
+		return o.Origin()
+	case *types.Func:
+		return o.Origin()
+	}
+	return obj
+}
+
+// sameObject reports whether a and b denote the same declaration
+func sameObject(fset *token.FileSet, a, b types.Object) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil || !a.Pos().IsValid() || !b.Pos().IsValid() {
+		return false
+	}
+	return keyOf(fset, a) == keyOf(fset, b)
+}
+
+// fileQualifier qualifies the types of other packages as code in f would:
+// by the name the package is imported as, or its own name if f does not
+// import it
+func fileQualifier(p *pkgInfo, f *ast.File) types.Qualifier {
+	return func(other *types.Package) string {
+		if other == p.pkg {
+			return ""
+		}
+		for _, s := range f.Imports {
+			obj := p.info.Implicits[s]
+			if s.Name != nil {
+				obj = p.info.Defs[s.Name]
+			}
+			if pn, ok := obj.(*types.PkgName); ok && pn.Imported() == other {
+				if s.Name != nil && s.Name.Name == "." {
+					return ""
+				}
+				return pn.Name()
+			}
+		}
+		return other.Name()
+	}
+}
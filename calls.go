@@ -0,0 +1,474 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/myitcv/neovim"
+)
+
+// callTreeBuffer is the name of the scratch buffer that shows the call tree
+const callTreeBuffer = "neogo-calls"
+
+// Callers shows the functions that call the function under the cursor (or
+// enclosing it) as a tree in a scratch buffer. <Tab> expands and collapses
+// the callers of an entry, <CR> jumps to the call. Exposed as NeogoCallers
+// and :NeogoCallers
+func (n *Neogo) Callers(o *neovim.MethodOptionParams) error {
+	return n.report(n.callTree(true))
+}
+
+// Callees is like Callers but shows the functions called by the function
+// under the cursor. Exposed as NeogoCallees and :NeogoCallees
+func (n *Neogo) Callees(o *neovim.MethodOptionParams) error {
+	return n.report(n.callTree(false))
+}
+
+// CallTreeToggle expands or collapses the entry on the 1-based line of the
+// call tree buffer. Exposed as NeogoCallTreeToggle, mapped to <Tab> there
+func (n *Neogo) CallTreeToggle(o *neovim.MethodOptionParams, line int) error {
+	return n.report(n.callTreeToggle(line))
+}
+
+// CallTreeJump jumps, in the previous window, to the position of the entry
+// on the 1-based line of the call tree buffer. Exposed as NeogoCallTreeJump,
+// mapped to <CR> there
+func (n *Neogo) CallTreeJump(o *neovim.MethodOptionParams, line int) error {
+	return n.report(n.callTreeJump(line))
+}
+
+// callGraph holds the calls made by the functions of a workspace. Calls in
+// function literals are attributed to the enclosing function declaration.
+// A call through an interface is taken to call the interface method and
+// every workspace method that could implement it; such calls are dynamic
+type callGraph struct {
+	fset  *token.FileSet
+	funcs map[objKey]*types.Func
+	out   map[objKey][]callEdge
+	in    map[objKey][]callEdge
+}
+
+type callEdge struct {
+	caller, callee objKey
+	pos            token.Position
+	dynamic        bool
+}
+
+// callNode is an entry in the call tree
+type callNode struct {
+	fn    objKey
+	pos   token.Position
+	calls int
+
+	dynamic  bool
+	depth    int
+	expanded bool
+
+	// children is nil until the node is first expanded
+	children []*callNode
+}
+
+// callTreeState is the call tree shown in the scratch buffer
+type callTreeState struct {
+	// mu guards the expansion of nodes and lines
+	mu sync.Mutex
+
+	g       *callGraph
+	callers bool
+	root    *callNode
+
+	// lines maps the lines of the buffer, after the title, to nodes
+	lines []*callNode
+}
+
+func (n *Neogo) callTree(callers bool) error {
+	if err := n.requireFeature(FeatureCalls); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	p, f, err := n.typeCheck(b)
+	if err != nil {
+		return err
+	}
+	fn := funcAt(p, f, filePos(n.ldr.fset, f, b.offset(b.line, b.col)))
+	if fn == nil {
+		return fmt.Errorf("no function under cursor")
+	}
+
+	g, err := n.callGraph(p.dir)
+	if err != nil {
+		return err
+	}
+	k := keyOf(g.fset, fn)
+	g.funcs[k] = fn
+
+	t := &callTreeState{
+		g:       g,
+		callers: callers,
+		root:    &callNode{fn: k, pos: g.fset.Position(fn.Pos())},
+	}
+	t.expand(t.root)
+
+	n.mu.Lock()
+	n.calls = t
+	n.mu.Unlock()
+
+	if err := n.openCallTree(); err != nil {
+		return err
+	}
+	return n.renderCallTree(t)
+}
+
+func (n *Neogo) callTreeToggle(line int) error {
+	n.mu.Lock()
+	t := n.calls
+	n.mu.Unlock()
+	if t == nil {
+		return fmt.Errorf("no call tree")
+	}
+	t.mu.Lock()
+	nd := t.node(line)
+	if nd != nil {
+		if nd.expanded {
+			nd.expanded = false
+		} else {
+			t.expand(nd)
+		}
+	}
+	t.mu.Unlock()
+	if nd == nil {
+		return nil
+	}
+	return n.renderCallTree(t)
+}
+
+func (n *Neogo) callTreeJump(line int) error {
+	n.mu.Lock()
+	t := n.calls
+	n.mu.Unlock()
+	if t == nil {
+		return fmt.Errorf("no call tree")
+	}
+	t.mu.Lock()
+	nd := t.node(line)
+	t.mu.Unlock()
+	if nd == nil {
+		return nil
+	}
+	if err := n.c.Command("wincmd p"); err != nil {
+		return err
+	}
+	cb, err := n.c.GetCurrentBuffer()
+	if err != nil {
+		return err
+	}
+	bn, err := cb.GetName()
+	if err != nil {
+		return err
+	}
+	if bn != "" {
+		bn, _ = filepath.Abs(bn)
+	}
+	return n.jumpTo(bn, nd.pos)
+}
+
+// openCallTree makes the call tree buffer the current one, creating it and
+// its window if need be
+func (n *Neogo) openCallTree() error {
+	name := vimString(callTreeBuffer)
+	return n.c.Command("if bufwinnr(" + name + ") > 0 | execute bufwinnr(" + name + ") 'wincmd w' | else | " +
+		"execute 'botright 15new' " + name + " | " +
+		"setlocal buftype=nofile bufhidden=wipe noswapfile nobuflisted nowrap nonumber | " +
+		"nnoremap <buffer> <silent> <Tab> :call NeogoCallTreeToggle(line('.'))<CR>| " +
+		"nnoremap <buffer> <silent> <CR> :call NeogoCallTreeJump(line('.'))<CR>| " +
+		"nnoremap <buffer> <silent> q :close<CR>| " +
+		"endif")
+}
+
+// renderCallTree replaces the contents of the current buffer, the call tree
+// buffer, with t
+func (n *Neogo) renderCallTree(t *callTreeState) error {
+	t.mu.Lock()
+	lines := t.render()
+	t.mu.Unlock()
+	return n.c.Command("setlocal modifiable | silent %delete _ | call setline(1, " + vimValue(lines) +
+		") | setlocal nomodifiable")
+}
+
+// node returns the node on the 1-based line of the buffer, or nil. Called
+// with t.mu held
+func (t *callTreeState) node(line int) *callNode {
+	if line < 2 || line-2 >= len(t.lines) {
+		return nil
+	}
+	return t.lines[line-2]
+}
+
+// expand computes the children of nd, if need be, and expands it. Called
+// with t.mu held, or before t is shared
+func (t *callTreeState) expand(nd *callNode) {
+	nd.expanded = true
+	if nd.children != nil {
+		return
+	}
+	edges := t.g.out[nd.fn]
+	if t.callers {
+		edges = t.g.in[nd.fn]
+	}
+	byFn := make(map[objKey]*callNode)
+	nd.children = []*callNode{}
+	for _, e := range edges {
+		k := e.callee
+		if t.callers {
+			k = e.caller
+		}
+		if c, ok := byFn[k]; ok {
+			c.calls++
+			c.dynamic = c.dynamic && e.dynamic
+			continue
+		}
+		c := &callNode{fn: k, pos: e.pos, calls: 1, dynamic: e.dynamic, depth: nd.depth + 1}
+		byFn[k] = c
+		nd.children = append(nd.children, c)
+	}
+}
+
+// render returns the lines of the buffer showing t. Called with t.mu held
+func (t *callTreeState) render() []string {
+	what := "Callees of "
+	if t.callers {
+		what = "Callers of "
+	}
+	res := []string{what + t.g.label(t.root.fn) + "  (<Tab> expand, <CR> jump)"}
+	t.lines = nil
+
+	var walk func(nd *callNode)
+	walk = func(nd *callNode) {
+		marker := "+ "
+		switch {
+		case nd.expanded && len(nd.children) == 0:
+			marker = "  "
+		case nd.expanded:
+			marker = "- "
+		}
+		l := strings.Repeat("  ", nd.depth) + marker + t.g.label(nd.fn) +
+			fmt.Sprintf("  %v:%v", filepath.Base(nd.pos.Filename), nd.pos.Line)
+		if nd.calls > 1 {
+			l += fmt.Sprintf(" (%v calls)", nd.calls)
+		}
+		if nd.dynamic {
+			l += " (dynamic)"
+		}
+		res = append(res, l)
+		t.lines = append(t.lines, nd)
+		if nd.expanded {
+			for _, c := range nd.children {
+				walk(c)
+			}
+		}
+	}
+	walk(t.root)
+	return res
+}
+
+// label names the function k like pkg.F or (*pkg.T).M
+func (g *callGraph) label(k objKey) string {
+	fn, ok := g.funcs[k]
+	if !ok {
+		return k.name
+	}
+	qual := func(p *types.Package) string { return p.Name() }
+	if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+		return "(" + types.TypeString(recv.Type(), qual) + ")." + fn.Name()
+	}
+	if fn.Pkg() == nil {
+		return fn.Name()
+	}
+	return fn.Pkg().Name() + "." + fn.Name()
+}
+
+// funcAt returns the function named at pos or, failing that, the function
+// declaration enclosing pos
+func funcAt(p *pkgInfo, f *ast.File, pos token.Pos) *types.Func {
+	if _, obj := objectAt(p, f, pos); obj != nil {
+		if fn, ok := obj.(*types.Func); ok {
+			return fn
+		}
+	}
+	for _, nd := range enclosing(f, pos) {
+		if d, ok := nd.(*ast.FuncDecl); ok {
+			fn, _ := p.info.Defs[d.Name].(*types.Func)
+			return fn
+		}
+	}
+	return nil
+}
+
+// callGraph computes the call graph of the workspace containing dir
+func (n *Neogo) callGraph(dir string) (*callGraph, error) {
+	universe, err := n.workspaceTypes(dir, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	root := workspaceRoot(dir)
+
+	g := &callGraph{
+		fset:  n.ldr.fset,
+		funcs: make(map[objKey]*types.Func),
+		out:   make(map[objKey][]callEdge),
+		in:    make(map[objKey][]callEdge),
+	}
+	seen := make(map[callEdge]bool)
+	add := func(caller, callee *types.Func, pos token.Pos, dynamic bool) {
+		e := callEdge{
+			caller:  keyOf(g.fset, caller),
+			callee:  keyOf(g.fset, callee),
+			pos:     g.fset.Position(pos),
+			dynamic: dynamic,
+		}
+		if seen[e] {
+			return
+		}
+		seen[e] = true
+		g.funcs[e.caller] = caller
+		g.funcs[e.callee] = callee
+		g.out[e.caller] = append(g.out[e.caller], e)
+		g.in[e.callee] = append(g.in[e.callee], e)
+	}
+
+	for _, d := range workspaceDirs(root) {
+		pkgs, err := n.ldr.checkAll(d)
+		if err != nil {
+			n.debugf("calls: skipping %v: %v", d, err)
+			continue
+		}
+		for _, p := range pkgs {
+			for _, f := range p.files {
+				for _, decl := range f.Decls {
+					fd, ok := decl.(*ast.FuncDecl)
+					if !ok || fd.Body == nil {
+						continue
+					}
+					caller, ok := p.info.Defs[fd.Name].(*types.Func)
+					if !ok {
+						continue
+					}
+					ast.Inspect(fd.Body, func(nd ast.Node) bool {
+						call, ok := nd.(*ast.CallExpr)
+						if !ok {
+							return true
+						}
+						for _, c := range callees(p, call, universe) {
+							add(caller, c.fn, callPos(call), c.dynamic)
+						}
+						return true
+					})
+				}
+			}
+		}
+	}
+
+	for _, es := range []map[objKey][]callEdge{g.out, g.in} {
+		for _, e := range es {
+			sort.Sort(callEdges(e))
+		}
+	}
+	return g, nil
+}
+
+// callPos returns the position of the name of the function called by call
+func callPos(call *ast.CallExpr) token.Pos {
+	if sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr); ok {
+		return sel.Sel.Pos()
+	}
+	return call.Pos()
+}
+
+type callTarget struct {
+	fn      *types.Func
+	dynamic bool
+}
+
+// callees returns the functions call may call. Calls of function values are
+// not resolved
+func callees(p *pkgInfo, call *ast.CallExpr, universe []*types.TypeName) []callTarget {
+	fun := ast.Unparen(call.Fun)
+	switch f := fun.(type) {
+	case *ast.IndexExpr:
+		fun = f.X
+	case *ast.IndexListExpr:
+		fun = f.X
+	}
+
+	var fn *types.Func
+	switch f := fun.(type) {
+	case *ast.Ident:
+		fn, _ = p.info.Uses[f].(*types.Func)
+	case *ast.SelectorExpr:
+		if sel, ok := p.info.Selections[f]; ok {
+			fn, _ = sel.Obj().(*types.Func)
+		} else {
+			fn, _ = p.info.Uses[f.Sel].(*types.Func)
+		}
+	}
+	if fn == nil {
+		return nil
+	}
+
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil || !types.IsInterface(recv.Type()) {
+		return []callTarget{{fn: fn}}
+	}
+
+	// interface dispatch
+	res := []callTarget{{fn: fn, dynamic: true}}
+	iface, _ := recv.Type().Underlying().(*types.Interface)
+	if iface == nil {
+		return res
+	}
+	for _, im := range implementationsOf(iface, universe) {
+		t := im.obj.Type()
+		if im.ptr {
+			t = types.NewPointer(t)
+		}
+		m, _, _ := types.LookupFieldOrMethod(t, false, fn.Pkg(), fn.Name())
+		if mf, ok := m.(*types.Func); ok {
+			res = append(res, callTarget{fn: mf, dynamic: true})
+		}
+	}
+	return res
+}
+
+type callEdges []callEdge
+
+func (c callEdges) Len() int      { return len(c) }
+func (c callEdges) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c callEdges) Less(i, j int) bool {
+	a, b := c[i], c[j]
+	if a.pos != b.pos {
+		return positions{a.pos, b.pos}.Less(0, 1)
+	}
+	for _, k := range [][2]objKey{{a.caller, b.caller}, {a.callee, b.callee}} {
+		if k[0] != k[1] {
+			ps := positions{k[0].pos, k[1].pos}
+			if k[0].name != k[1].name {
+				return k[0].name < k[1].name
+			}
+			return ps.Less(0, 1)
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package neogo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+const callsTestSrc = `package a
+
+type I interface{ M() }
+
+type T struct{}
+
+func (T) M() {}
+
+func F(i I) {
+	i.M()
+	G()
+}
+
+func G() {
+	F(T{})
+}
+
+func H() {
+	defer func() { G() }()
+}
+`
+
+func (t *PluginTest) TestCalls(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": callsTestSrc,
+		"b/b.go": "package b\n\nimport \"example.com/p/a\"\n\nfunc B() { a.G() }\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+
+	afn := filepath.Join(root, "a", "a.go")
+	t.nvim.setBuffer(afn, strings.TrimSuffix(callsTestSrc, "\n"))
+
+	lastTree := func() []string {
+		cmds := t.nvim.recorded("vim_command", "nvim_command")
+		for i := len(cmds) - 1; i >= 0; i-- {
+			if s := cmds[i].Args[0].(string); strings.Contains(s, "call setline(1, ") {
+				return strings.Split(s, "', '")
+			}
+		}
+		return nil
+	}
+	check := func(want ...string) {
+		got := lastTree()
+		c.Assert(len(got), Equals, len(want), Commentf("%q", got))
+		for i := range want {
+			c.Check(strings.Contains(got[i], want[i]), Equals, true, Commentf("line %v: %q", i, got[i]))
+		}
+	}
+
+	t.nvim.setCursor(14, "G", 0)
+	c.Assert(t.plug.Callers(nil), IsNil)
+	check(
+		"Callers of a.G",
+		"- a.G  a.go:14",
+		"  + a.F  a.go:11",
+		"  + a.H  a.go:19",
+		"  + b.B  b.go:5",
+	)
+
+	c.Assert(t.plug.CallTreeToggle(nil, 3), IsNil)
+	check(
+		"Callers of a.G",
+		"- a.G  a.go:14",
+		"  - a.F  a.go:11",
+		"    + a.G  a.go:15",
+		"  + a.H  a.go:19",
+		"  + b.B  b.go:5",
+	)
+
+	t.nvim.setCursor(10, "i.M", 0)
+	c.Assert(t.plug.Callees(nil), IsNil)
+	check(
+		"Callees of a.F",
+		"- a.F  a.go:9",
+		"  + (a.I).M  a.go:10 (dynamic)",
+		"  + (a.T).M  a.go:10 (dynamic)",
+		"  + a.G  a.go:11",
+	)
+
+	c.Assert(t.plug.CallTreeJump(nil, 5), IsNil)
+	fn, cur := t.nvim.current()
+	c.Assert(fn, Equals, afn)
+	c.Assert(cur, Equals, [2]int{11, 2})
+}
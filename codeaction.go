@@ -0,0 +1,194 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"github.com/myitcv/neovim"
+	"golang.org/x/tools/go/analysis"
+)
+
+// codeAction is a change that can be made to the current buffer
+type codeAction struct {
+	title string
+	apply func() error
+}
+
+// CodeAction lists the code actions for the cursor line and applies the one
+// chosen. They are the fixes suggested by go/analysis analyzers for what
+// they report on the line, and those of neogo's refactorings that apply
+// there and need nothing more from the user: filling a struct literal,
+// inserting an error check, adding or removing json tags, organizing
+// imports and formatting. Exposed as NeogoCodeAction and :NeogoCodeAction
+func (n *Neogo) CodeAction(o *neovim.MethodOptionParams) error {
+	return n.report(n.codeAction())
+}
+
+func (n *Neogo) codeAction() error {
+	if err := n.requireFeature(FeatureCodeAction); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	p, f, err := n.typeCheck(b)
+	if err != nil {
+		return err
+	}
+	fset := n.ldr.fset
+
+	var actions []codeAction
+	diags, err := analyze(fset, p, types.SizesFor("gc", n.ldr.ctxt.GOARCH), analyzers)
+	if err != nil {
+		// the analyzers that did not fail still reported
+		n.debugf("codeaction: %v", err)
+	}
+	for _, d := range diags {
+		start, end := fset.Position(d.Pos), fset.Position(d.Pos)
+		if d.End.IsValid() {
+			end = fset.Position(d.End)
+		}
+		if start.Filename != b.name || b.line < start.Line || b.line > end.Line {
+			continue
+		}
+		for _, fix := range d.SuggestedFixes {
+			edits, ok := fixEdits(fset, f, b, fix.TextEdits)
+			if !ok {
+				continue
+			}
+			actions = append(actions, codeAction{
+				title: d.analyzer + ": " + fix.Message,
+				apply: func() error { return n.applyEdits(edits) },
+			})
+		}
+	}
+	actions = append(actions, n.refactorings(p, f, b)...)
+
+	if actions == nil {
+		n.echo("no code actions")
+		return nil
+	}
+	titles := make([]string, len(actions))
+	for i, a := range actions {
+		titles[i] = a.title
+	}
+	i, err := n.pick("Code actions:", titles)
+	if err != nil || i < 0 {
+		return err
+	}
+	return actions[i].apply()
+}
+
+// refactorings returns the code actions of neogo's own refactorings that
+// apply at the cursor, of the features enabled
+func (n *Neogo) refactorings(p *pkgInfo, f *ast.File, b *bufferState) []codeAction {
+	cfg := n.config()
+	fset := n.ldr.fset
+	pos := filePos(fset, f, b.offset(b.line, b.col))
+	var res []codeAction
+
+	if cfg.Enabled(FeatureFillStruct) {
+		if lit := structLitAt(p, f, pos); lit != nil {
+			if _, err := fillStructEdit(fset, p, f, b.lines, lit, false); err == nil {
+				res = append(res,
+					codeAction{title: "Fill struct", apply: func() error { return n.fillStruct(false) }},
+					codeAction{title: "Fill struct recursively", apply: func() error { return n.fillStruct(true) }},
+				)
+			}
+		}
+	}
+	if cfg.Enabled(FeatureIfErr) && assignsError(fset, p, f, b) {
+		res = append(res, codeAction{title: "Add if err != nil", apply: n.ifErr})
+	}
+	if cfg.Enabled(FeatureTags) {
+		line := func(p token.Pos) int { return fset.Position(p).Line }
+		if fields, _ := taggedFields(f, line, 0, 0, pos); fields != nil {
+			tagged := false
+			for _, fld := range fields {
+				tagged = tagged || fld.Tag != nil
+			}
+			res = append(res, codeAction{title: "Add json tags", apply: func() error { return n.tags(0, 0, "json", true) }})
+			if tagged {
+				res = append(res, codeAction{title: "Remove tags", apply: func() error { return n.tags(0, 0, "", false) }})
+			}
+		}
+	}
+	if cfg.Enabled(FeatureImports) && (len(unusedImports(p, f)) > 0 || len(missingImports(p, f)) > 0) {
+		res = append(res, codeAction{title: "Organize imports", apply: n.organizeImports})
+	}
+	if cfg.Enabled(FeatureFmt) {
+		if edits, err := formatEdits(b.lines); err == nil && len(edits) > 0 {
+			res = append(res, codeAction{title: "Format file", apply: n.fmt})
+		}
+	}
+	return res
+}
+
+// assignsError reports whether the statement on the cursor line, within a
+// function, assigns an error
+func assignsError(fset *token.FileSet, p *pkgInfo, f *ast.File, b *bufferState) bool {
+	pos := filePos(fset, f, b.offset(b.line, len(leadingSpace(b.lines[b.line-1]))+1))
+	inFunc := false
+	var as *ast.AssignStmt
+	for _, nd := range enclosing(f, pos) {
+		switch nd := nd.(type) {
+		case *ast.AssignStmt:
+			if as == nil {
+				as = nd
+			}
+		case *ast.FuncDecl, *ast.FuncLit:
+			inFunc = true
+		}
+	}
+	if !inFunc || as == nil {
+		return false
+	}
+	for _, lhs := range as.Lhs {
+		if id, ok := lhs.(*ast.Ident); ok && isError(p.info.ObjectOf(id)) {
+			return true
+		}
+	}
+	return false
+}
+
+// fixEdits returns the edits of the buffer b, the source of f, that make
+// the text edits of a suggested fix, or false if they are not all within
+// f or overlap
+func fixEdits(fset *token.FileSet, f *ast.File, b *bufferState, tes []analysis.TextEdit) ([]lineEdit, bool) {
+	tf := fset.File(f.Pos())
+	src := b.src()
+	sorted := append([]analysis.TextEdit(nil), tes...)
+	sort.Sort(byTextEditPos(sorted))
+	var res []byte
+	last := 0
+	for _, te := range sorted {
+		end := te.End
+		if !end.IsValid() {
+			end = te.Pos
+		}
+		if fset.File(te.Pos) != tf || fset.File(end) != tf {
+			return nil, false
+		}
+		from, to := tf.Offset(te.Pos), tf.Offset(end)
+		if from < last || to < from || to > len(src) {
+			return nil, false
+		}
+		res = append(append(res, src[last:from]...), te.NewText...)
+		last = to
+	}
+	res = append(res, src[last:]...)
+	return lineDiff(b.lines, srcLines(res)), true
+}
+
+type byTextEditPos []analysis.TextEdit
+
+func (t byTextEditPos) Len() int           { return len(t) }
+func (t byTextEditPos) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t byTextEditPos) Less(i, j int) bool { return t[i].Pos < t[j].Pos }
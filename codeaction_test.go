@@ -0,0 +1,90 @@
+package neogo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	. "gopkg.in/check.v1"
+)
+
+const codeActionTestSrc = `package a
+
+import "example.com/p/b"
+
+func f() (int, error) {
+	x, err := g()
+	x = x
+	_ = b.P{1, 2}
+	_ = b.P{}
+	return x, err
+}
+
+func g() (int, error) { return 0, nil }`
+
+func (t *PluginTest) TestCodeAction(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": codeActionTestSrc + "\n",
+		"b/b.go": "package b\n\ntype P struct{ X, Y int }\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+	afn := filepath.Join(root, "a", "a.go")
+
+	var listed string
+	choice := 0
+	t.nvim.handleEval(`^inputlist\((.*)\)$`, func(m []string) (interface{}, error) {
+		listed = m[1]
+		return int64(choice), nil
+	})
+	action := func(line int, marker string, chosen int) (string, error) {
+		t.nvim.setBuffer(afn, codeActionTestSrc)
+		t.nvim.setCursor(line, marker, 0)
+		listed, choice = "", chosen
+		err := t.plug.CodeAction(nil)
+		return strings.Join(t.nvim.bufferLines(), "\n"), err
+	}
+
+	res, err := action(8, "_", 1)
+	c.Assert(err, IsNil)
+	c.Assert(listed, Equals, `['Code actions:', '1. composites: Add field names to struct literal']`)
+	c.Assert(strings.Split(res, "\n")[7], Equals, "\t_ = b.P{X: 1, Y: 2}")
+
+	res, err = action(7, "x", 1)
+	c.Assert(err, IsNil)
+	c.Assert(listed, Equals, `['Code actions:', '1. assign: Remove self-assignment']`)
+	c.Assert(strings.Contains(res, "x = x"), Equals, false)
+
+	res, err = action(9, "{", 2)
+	c.Assert(err, IsNil)
+	c.Assert(listed, Equals, `['Code actions:', '1. Fill struct', '2. Fill struct recursively']`)
+	c.Assert(strings.Split(res, "\n")[8:12], DeepEquals, []string{"\t_ = b.P{", "\t\tX: 0,", "\t\tY: 0,", "\t}"})
+
+	// nothing chosen
+	res, err = action(6, "x", 0)
+	c.Assert(err, IsNil)
+	c.Assert(listed, Equals, `['Code actions:', '1. Add if err != nil']`)
+	c.Assert(res, Equals, codeActionTestSrc)
+
+	// none on the package clause
+	t.nvim.setBuffer(afn, codeActionTestSrc)
+	t.nvim.setCursor(1, "", 0)
+	listed = ""
+	c.Assert(t.plug.CodeAction(nil), IsNil)
+	c.Assert(listed, Equals, "")
+
+	// an analyzer that fails does not hide the fixes of those after it
+	failing := &analysis.Analyzer{
+		Name: "failing",
+		Doc:  "fails",
+		Run:  func(*analysis.Pass) (interface{}, error) { return nil, fmt.Errorf("oops") },
+	}
+	defer func(as []*analysis.Analyzer) { analyzers = as }(analyzers)
+	analyzers = append([]*analysis.Analyzer{failing}, analyzers...)
+	res, err = action(8, "_", 1)
+	c.Assert(err, IsNil)
+	c.Assert(listed, Equals, `['Code actions:', '1. composites: Add field names to struct literal']`)
+	c.Assert(strings.Split(res, "\n")[7], Equals, "\t_ = b.P{X: 1, Y: 2}")
+}
@@ -0,0 +1,491 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/myitcv/neovim"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// Ranks of completions; lower ranks are listed first. Identifiers in scope
+// are ranked by the depth of their scope, counting from rankScope for the
+// innermost
+const (
+	rankField      = 0
+	rankScope      = 1
+	rankUnimported = 1000
+)
+
+// Complete is the omnifunc: with findstart set it returns the byte column
+// where the identifier being completed starts, otherwise the completions of
+// base there. Completed are selectors of packages and values, fields in
+// struct literals, identifiers in scope and standard library packages not
+// yet imported. Exposed as the synchronous NeogoComplete; set omnifunc to it
+func (n *Neogo) Complete(o *neovim.MethodOptionParams, findstart int, base string) (*completeResult, error) {
+	res, err := n.complete(findstart != 0, base)
+	if err != nil {
+		n.errorf("complete: %v", err)
+	}
+	return res, err
+}
+
+// completion is an entry in the completion menu
+type completion struct {
+	word string
+	kind string
+	menu string
+	info string
+	rank int
+
+	// userData is passed to NeogoCompleteDone once the item is chosen
+	userData string
+}
+
+// completeResult is the result of the omnifunc: the start column when
+// findstart is set, the completions otherwise
+type completeResult struct {
+	findstart bool
+	start     int
+	items     []completion
+}
+
+func (c *completeResult) EncodeMsg(w *msgp.Writer) error {
+	if c.findstart {
+		return w.WriteInt(c.start)
+	}
+	if err := w.WriteArrayHeader(uint32(len(c.items))); err != nil {
+		return err
+	}
+	for _, it := range c.items {
+		fields := [][2]string{
+			{"word", it.word},
+			{"kind", it.kind},
+			{"menu", it.menu},
+			{"info", it.info},
+		}
+		if it.userData != "" {
+			fields = append(fields, [2]string{"user_data", it.userData})
+		}
+		if err := w.WriteMapHeader(uint32(len(fields))); err != nil {
+			return err
+		}
+		for _, f := range fields {
+			if err := w.WriteString(f[0]); err != nil {
+				return err
+			}
+			if err := w.WriteString(f[1]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (n *Neogo) complete(findstart bool, base string) (*completeResult, error) {
+	res := &completeResult{findstart: findstart}
+	if err := n.requireFeature(FeatureComplete); err != nil {
+		// let Vim know there is nothing to complete
+		res.start = -3
+		return res, err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		res.start = -3
+		return res, err
+	}
+	if findstart {
+		res.start = identStart(b.lines[b.line-1], b.col-1)
+		return res, nil
+	}
+
+	// Vim has removed base from the buffer; the cursor is where it was
+	p, f, err := n.typeCheck(b)
+	if err != nil {
+		return res, err
+	}
+	src := b.src()
+	off := b.offset(b.line, b.col)
+	pos := filePos(n.ldr.fset, f, off)
+
+	var items []completion
+	if off > 0 && src[off-1] == '.' {
+		items = n.selectorCompletions(p, f, off-1)
+	} else {
+		items = append(n.literalCompletions(p, f, pos), n.scopeCompletions(p, f, pos, base != "")...)
+	}
+
+	filtered := items[:0]
+	for _, it := range items {
+		if len(it.word) >= len(base) && strings.EqualFold(it.word[:len(base)], base) {
+			filtered = append(filtered, it)
+		}
+	}
+	sort.Stable(completions(filtered))
+	res.items = filtered
+	return res, nil
+}
+
+// identStart returns the byte index in line of the start of the identifier
+// that ends at col
+func identStart(line string, col int) int {
+	if col > len(line) {
+		col = len(line)
+	}
+	for col > 0 {
+		r, size := utf8.DecodeLastRuneInString(line[:col])
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		col -= size
+	}
+	return col
+}
+
+// selectorCompletions completes the selector whose dot is at the byte
+// offset dot: the exported members of a package, or the fields and methods
+// of a value or the methods of a type. A package that is not imported is
+// looked for in the standard library; choosing one of its members imports it
+func (n *Neogo) selectorCompletions(p *pkgInfo, f *ast.File, dot int) []completion {
+	tf := n.ldr.fset.File(f.Pos())
+	var x ast.Expr
+	ast.Inspect(f, func(nd ast.Node) bool {
+		if sel, ok := nd.(*ast.SelectorExpr); ok && tf.Offset(sel.X.End()) == dot {
+			x = sel.X
+		}
+		return x == nil
+	})
+	if x == nil {
+		return nil
+	}
+
+	qual := types.RelativeTo(p.pkg)
+	var res []completion
+	if id, ok := x.(*ast.Ident); ok {
+		var pkg *types.Package
+		var userData string
+		if pn, ok := p.info.Uses[id].(*types.PkgName); ok {
+			pkg = pn.Imported()
+		} else if p.info.Uses[id] == nil && !inScope(p, id) {
+			pkg, userData = n.unimported(id.Name)
+		}
+		if pkg != nil {
+			s := pkg.Scope()
+			for _, name := range s.Names() {
+				if obj := s.Lookup(name); obj.Exported() {
+					c := objectCompletion(obj, rankScope, qual)
+					if userData != "" {
+						c.userData = userData
+						c.info += "\n\nimports " + strconv.Quote(pkg.Path())
+					}
+					res = append(res, c)
+				}
+			}
+			return res
+		}
+	}
+
+	tv, ok := p.info.Types[x]
+	if !ok || tv.Type == nil {
+		return nil
+	}
+	for _, obj := range members(tv.Type, p.pkg, !tv.IsType()) {
+		res = append(res, objectCompletion(obj, rankScope, qual))
+	}
+	return res
+}
+
+// inScope reports whether id names something in scope where it appears
+func inScope(p *pkgInfo, id *ast.Ident) bool {
+	s := p.pkg.Scope().Innermost(id.Pos())
+	if s == nil {
+		return false
+	}
+	_, obj := s.LookupParent(id.Name, id.Pos())
+	return obj != nil
+}
+
+// unimported returns the standard library package called name, loaded, and
+// the user_data that imports it. Of several, the one with the shortest path
+// is taken: math/rand over crypto/rand and math/rand/v2
+func (n *Neogo) unimported(name string) (*types.Package, string) {
+	var best string
+	for _, sp := range n.stdlib() {
+		if sp.name == name && (best == "" || len(sp.path) < len(best)) {
+			best = sp.path
+		}
+	}
+	if best == "" {
+		return nil, ""
+	}
+	p, err := n.ldr.checkDir(filepath.Join(n.ldr.ctxt.GOROOT, "src", filepath.FromSlash(best)))
+	if err != nil || p.pkg == nil {
+		n.debugf("complete: loading %v: %v", best, err)
+		return nil, ""
+	}
+	return p.pkg, importUserData + best
+}
+
+// members returns the methods of t, and with fields its fields, that are
+// visible from pkg; promoted members included
+func members(t types.Type, pkg *types.Package, fields bool) []types.Object {
+	visible := func(obj types.Object) bool {
+		return obj.Exported() || obj.Pkg() == pkg
+	}
+	seen := make(map[string]bool)
+	var res []types.Object
+
+	mt := t
+	if _, isPtr := t.Underlying().(*types.Pointer); !isPtr && !types.IsInterface(t) {
+		// values are taken to be addressable
+		mt = types.NewPointer(t)
+	}
+	ms := types.NewMethodSet(mt)
+	for i := 0; i < ms.Len(); i++ {
+		if obj := ms.At(i).Obj(); visible(obj) && !seen[obj.Name()] {
+			seen[obj.Name()] = true
+			res = append(res, obj)
+		}
+	}
+	if !fields {
+		return res
+	}
+
+	// breadth first through embedded fields, so that shallower fields win
+	structs := []types.Type{t}
+	done := make(map[types.Type]bool)
+	for len(structs) > 0 {
+		var next []types.Type
+		for _, st := range structs {
+			if ptr, ok := st.Underlying().(*types.Pointer); ok {
+				st = ptr.Elem()
+			}
+			s, ok := st.Underlying().(*types.Struct)
+			if !ok || done[st] {
+				continue
+			}
+			done[st] = true
+			for i := 0; i < s.NumFields(); i++ {
+				fld := s.Field(i)
+				if visible(fld) && !seen[fld.Name()] {
+					seen[fld.Name()] = true
+					res = append(res, fld)
+				}
+				if fld.Embedded() {
+					next = append(next, fld.Type())
+				}
+			}
+		}
+		structs = next
+	}
+	return res
+}
+
+// literalCompletions completes the keys of a struct literal enclosing pos:
+// the fields not yet given
+func (n *Neogo) literalCompletions(p *pkgInfo, f *ast.File, pos token.Pos) []completion {
+	var lit *ast.CompositeLit
+	for _, nd := range enclosing(f, pos) {
+		switch nd := nd.(type) {
+		case *ast.KeyValueExpr:
+			if pos > nd.Colon {
+				// a value, not a key
+				return nil
+			}
+		case *ast.CompositeLit:
+			lit = nd
+		}
+		if lit != nil {
+			break
+		}
+	}
+	if lit == nil || pos <= lit.Lbrace || pos > lit.Rbrace {
+		return nil
+	}
+	tv, ok := p.info.Types[lit]
+	if !ok || tv.Type == nil {
+		return nil
+	}
+	t := tv.Type.Underlying()
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem().Underlying()
+	}
+	s, ok := t.(*types.Struct)
+	if !ok {
+		return nil
+	}
+
+	given := make(map[string]bool)
+	for _, e := range lit.Elts {
+		if kv, ok := e.(*ast.KeyValueExpr); ok {
+			if id, ok := kv.Key.(*ast.Ident); ok {
+				given[id.Name] = true
+			}
+		}
+	}
+	qual := types.RelativeTo(p.pkg)
+	var res []completion
+	for i := 0; i < s.NumFields(); i++ {
+		fld := s.Field(i)
+		if given[fld.Name()] || !(fld.Exported() || fld.Pkg() == p.pkg) {
+			continue
+		}
+		res = append(res, objectCompletion(fld, rankField, qual))
+	}
+	return res
+}
+
+// scopeCompletions completes the identifiers in scope at pos, nearer scopes
+// first, and with unimported the standard library packages the file does
+// not import
+func (n *Neogo) scopeCompletions(p *pkgInfo, f *ast.File, pos token.Pos, unimported bool) []completion {
+	fileScope := p.info.Scopes[f]
+	scope := fileScope
+	if s := p.pkg.Scope().Innermost(pos); s != nil && s != p.pkg.Scope() {
+		scope = s
+	}
+	if scope == nil {
+		return nil
+	}
+
+	qual := types.RelativeTo(p.pkg)
+	seen := make(map[string]bool)
+	var res []completion
+	for depth := 0; scope != nil; depth, scope = depth+1, scope.Parent() {
+		local := scope != fileScope && scope != p.pkg.Scope() && scope != types.Universe
+		for _, name := range scope.Names() {
+			obj := scope.Lookup(name)
+			if seen[name] || name == "_" || name == "init" && scope == p.pkg.Scope() {
+				continue
+			}
+			if local && obj.Pos() >= pos {
+				// declared after pos
+				continue
+			}
+			seen[name] = true
+			res = append(res, objectCompletion(obj, rankScope+depth, qual))
+		}
+	}
+
+	if unimported {
+		for _, sp := range n.stdlib() {
+			if seen[sp.name] {
+				continue
+			}
+			res = append(res, completion{
+				word:     sp.name,
+				kind:     "p",
+				menu:     sp.path,
+				info:     "imports " + strconv.Quote(sp.path),
+				rank:     rankUnimported,
+				userData: importUserData + sp.path,
+			})
+		}
+	}
+	return res
+}
+
+// objectCompletion describes obj as a completion
+func objectCompletion(obj types.Object, rank int, qual types.Qualifier) completion {
+	c := completion{word: obj.Name(), rank: rank, info: types.ObjectString(obj, qual)}
+	switch obj := obj.(type) {
+	case *types.Var:
+		c.kind = "v"
+		if obj.IsField() {
+			c.kind = "m"
+		}
+		c.menu = types.TypeString(obj.Type(), qual)
+	case *types.Func:
+		c.kind = "f"
+		c.menu = types.TypeString(obj.Type(), qual)
+	case *types.TypeName:
+		c.kind = "t"
+		switch u := obj.Type().Underlying().(type) {
+		case *types.Struct:
+			c.menu = "struct"
+		case *types.Interface:
+			c.menu = "interface"
+		default:
+			c.menu = types.TypeString(u, qual)
+		}
+	case *types.Const:
+		c.kind = "c"
+		c.menu = types.TypeString(obj.Type(), qual)
+	case *types.PkgName:
+		c.kind = "p"
+		c.menu = obj.Imported().Path()
+	case *types.Builtin:
+		c.kind = "f"
+		c.menu = "builtin"
+	default:
+		c.kind = "v"
+		c.menu = obj.Type().String()
+	}
+	return c
+}
+
+type completions []completion
+
+func (c completions) Len() int      { return len(c) }
+func (c completions) Swap(i, j int) { c[i], c[j] = c[j], c[i] }
+func (c completions) Less(i, j int) bool {
+	if c[i].rank != c[j].rank {
+		return c[i].rank < c[j].rank
+	}
+	return c[i].word < c[j].word
+}
+
+// stdPackage is a package of the standard library
+type stdPackage struct {
+	name, path string
+}
+
+var versionSuffix = regexp.MustCompile(`^v[0-9]+$`)
+
+// stdlib returns the importable packages of the standard library, assuming
+// each is named after its directory, sorted by path
+func (n *Neogo) stdlib() []stdPackage {
+	n.stdlibOnce.Do(func() {
+		src := filepath.Join(n.ldr.ctxt.GOROOT, "src")
+		filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+			if err != nil || !fi.IsDir() {
+				return nil
+			}
+			name := fi.Name()
+			if path != src && (name == "internal" || name == "vendor" || name == "testdata" || name == "cmd" ||
+				strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			if path == src {
+				return nil
+			}
+			if gs, _ := filepath.Glob(filepath.Join(path, "*.go")); len(gs) == 0 {
+				return nil
+			}
+			ip := filepath.ToSlash(strings.TrimPrefix(path, src+string(filepath.Separator)))
+			if versionSuffix.MatchString(name) {
+				name = filepath.Base(filepath.Dir(path))
+			}
+			if ip == "builtin" {
+				// documentation only
+				return nil
+			}
+			n.std = append(n.std, stdPackage{name: name, path: ip})
+			return nil
+		})
+	})
+	return n.std
+}
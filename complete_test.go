@@ -0,0 +1,86 @@
+package neogo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+const completeTestSrc = `package a
+
+import "strings"
+
+type T struct {
+	Name string
+	age  int
+}
+
+func (t *T) Hello() string { return strings.ToUpper(t.Name) }
+
+var global = 1
+
+func f(x int) {
+	y := 2
+	var t T
+	_, _ = y, t
+	%v
+}
+`
+
+func (t *PluginTest) TestComplete(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": strings.Replace(completeTestSrc, "%v", "", 1),
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+	afn := filepath.Join(root, "a", "a.go")
+
+	// complete sets the line being typed, with the cursor after marker,
+	// and returns the words offered for base
+	complete := func(line, marker, base string) []completion {
+		t.nvim.setBuffer(afn, strings.Replace(completeTestSrc, "%v", line, 1))
+		t.nvim.setCursor(18, marker, len(marker))
+		res, err := t.plug.Complete(nil, 0, base)
+		c.Assert(err, IsNil)
+		return res.items
+	}
+	words := func(items []completion) []string {
+		var res []string
+		for _, it := range items {
+			res = append(res, it.word)
+		}
+		return res
+	}
+
+	t.nvim.setBuffer(afn, strings.Replace(completeTestSrc, "%v", "_ = strings.ToU", 1))
+	t.nvim.setCursor(18, "ToU", 3)
+	res, err := t.plug.Complete(nil, 1, "")
+	c.Assert(err, IsNil)
+	c.Assert(res.start, Equals, strings.Index("\t_ = strings.ToU", "ToU"))
+
+	items := complete("_ = strings.", "strings.", "ToUpper")
+	c.Assert(words(items), DeepEquals, []string{"ToUpper", "ToUpperSpecial"})
+	c.Assert(items[0].kind, Equals, "f")
+	c.Assert(items[0].menu, Equals, "func(s string) string")
+
+	items = complete("_ = t.", "t.", "")
+	c.Assert(words(items), DeepEquals, []string{"Hello", "Name", "age"})
+	c.Assert(items[1].kind, Equals, "m")
+	c.Assert(items[1].menu, Equals, "string")
+
+	items = complete("_ = T{Name: \"\", }", "\"\", ", "")
+	c.Assert(words(items)[:2], DeepEquals, []string{"age", "t"})
+
+	c.Assert(words(complete("_ = ", "= ", "gl")), DeepEquals, []string{"global"})
+	c.Assert(words(complete("_ = ", "= ", "strin")), DeepEquals, []string{"strings", "string"})
+
+	items = complete("_ = ", "= ", "strconv")
+	c.Assert(words(items), DeepEquals, []string{"strconv"})
+	c.Assert(items[0].kind, Equals, "p")
+	c.Assert(items[0].menu, Equals, "strconv")
+
+	// nearer scopes first
+	c.Assert(words(complete("_ = ", "= ", ""))[:6], DeepEquals, []string{"t", "x", "y", "strings", "T", "f"})
+}
@@ -0,0 +1,376 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/myitcv/neovim"
+)
+
+// Feature names as they appear in g:neogo_features
+const (
+	FeatureHighlight  = "highlight"
+	FeatureDefinition = "definition"
+	FeatureReferences = "references"
+	FeatureImplements = "implements"
+	FeatureOutline    = "outline"
+	FeatureSymbols    = "symbols"
+	FeatureCalls      = "calls"
+	FeatureHover      = "hover"
+	FeatureSignature  = "signature"
+	FeatureComplete   = "complete"
+	FeatureFmt        = "fmt"
+	FeatureImports    = "imports"
+	FeatureRename     = "rename"
+	FeatureExtract    = "extract"
+	FeatureFillStruct = "fillstruct"
+	FeatureImpl       = "impl"
+	FeatureTags       = "tags"
+	FeatureIfErr      = "iferr"
+	FeatureCodeAction = "codeaction"
+	FeatureTest       = "test"
+)
+
+var allFeatures = []string{
+	FeatureHighlight,
+	FeatureDefinition,
+	FeatureReferences,
+	FeatureImplements,
+	FeatureOutline,
+	FeatureSymbols,
+	FeatureCalls,
+	FeatureHover,
+	FeatureSignature,
+	FeatureComplete,
+	FeatureFmt,
+	FeatureImports,
+	FeatureRename,
+	FeatureExtract,
+	FeatureFillStruct,
+	FeatureImpl,
+	FeatureTags,
+	FeatureIfErr,
+	FeatureCodeAction,
+	FeatureTest,
+}
+
+type LogLevel uint32
+
+const (
+	LogError LogLevel = iota
+	LogInfo
+	LogDebug
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogError:
+		return "error"
+	case LogInfo:
+		return "info"
+	case LogDebug:
+		return "debug"
+	default:
+		panic("Unknown const mapping")
+	}
+}
+
+// ParseLogLevel returns the LogLevel named s
+func ParseLogLevel(s string) (LogLevel, error) {
+	for _, l := range []LogLevel{LogError, LogInfo, LogDebug} {
+		if l.String() == s {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// Config is the runtime configuration of neogo. Each field can be set from
+// Neovim via the g:neogo_* variable named in its comment; a variable that is
+// not set leaves the field at its default (see DefaultConfig).
+type Config struct {
+	// Features is the set of enabled features, g:neogo_features, a list of
+	// feature names. Default: every feature.
+	Features map[string]bool
+
+	// Debounce is how long neogo waits after the last buffer change before
+	// re-parsing, g:neogo_debounce in milliseconds. Default: 50ms.
+	Debounce time.Duration
+
+	// MaxFileSize is the size in bytes above which a buffer is not
+	// highlighted, g:neogo_max_file_size. Zero means no limit. Default: 1MiB.
+	MaxFileSize int
+
+	// Semantic, g:neogo_semantic, turns off Neovim's regex-based syntax in
+	// buffers neogo highlights so that only AST-derived highlighting remains.
+	// Default: off.
+	Semantic bool
+
+	// FmtOnSave, g:neogo_fmt_on_save, formats buffers with gofmt before they
+	// are written. Default: off.
+	FmtOnSave bool
+
+	// ImportsOnSave, g:neogo_imports_on_save, organizes the imports of
+	// buffers before they are written. Default: off.
+	ImportsOnSave bool
+
+	// LocalPrefix, g:neogo_local_prefix, is a comma-separated list of import
+	// path prefixes whose imports are grouped after third party ones.
+	// Default: the path of the enclosing module.
+	LocalPrefix string
+
+	// TagTransform, g:neogo_tag_transform, is how :NeogoAddTags derives tag
+	// values from field names: "snakecase" or "camelcase". Default:
+	// "snakecase".
+	TagTransform string
+
+	// LogLevel is one of "error", "info" or "debug", g:neogo_log_level.
+	// Default: "error".
+	LogLevel LogLevel
+
+	// DebugAST prints the AST of each parse, g:neogo_debug_ast. Default: off.
+	DebugAST bool
+}
+
+// DefaultConfig returns the configuration neogo uses in the absence of any
+// g:neogo_* variables.
+func DefaultConfig() Config {
+	res := Config{
+		Features:     make(map[string]bool),
+		Debounce:     50 * time.Millisecond,
+		MaxFileSize:  1 << 20,
+		TagTransform: "snakecase",
+		LogLevel:     LogError,
+	}
+	for _, f := range allFeatures {
+		res.Features[f] = true
+	}
+	return res
+}
+
+// Enabled reports whether the named feature is enabled
+func (c Config) Enabled(feature string) bool {
+	return c.Features[feature]
+}
+
+func (c Config) copy() Config {
+	fs := make(map[string]bool, len(c.Features))
+	for k, v := range c.Features {
+		fs[k] = v
+	}
+	c.Features = fs
+	return c
+}
+
+// apply sets the fields of c from vars, a map of g:neogo_* variable names
+// (without the g:neogo_ prefix) to their values as decoded from Neovim
+func (c *Config) apply(vars map[string]interface{}) error {
+	var errs []string
+	fail := func(k string, v interface{}, want string) {
+		errs = append(errs, fmt.Sprintf("g:neogo_%v: expected %v, got %T", k, want, v))
+	}
+
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := vars[k]
+		switch k {
+		case "features":
+			l, ok := v.([]interface{})
+			if !ok {
+				fail(k, v, "list")
+				continue
+			}
+			fs := make(map[string]bool)
+			for _, f := range l {
+				s, ok := f.(string)
+				if !ok || !KnownFeature(s) {
+					errs = append(errs, fmt.Sprintf("g:neogo_features: unknown feature %v", f))
+					continue
+				}
+				fs[s] = true
+			}
+			c.Features = fs
+		case "debounce":
+			i, ok := toInt(v)
+			if !ok || i < 0 {
+				fail(k, v, "non-negative number")
+				continue
+			}
+			c.Debounce = time.Duration(i) * time.Millisecond
+		case "max_file_size":
+			i, ok := toInt(v)
+			if !ok || i < 0 {
+				fail(k, v, "non-negative number")
+				continue
+			}
+			c.MaxFileSize = i
+		case "semantic":
+			i, ok := toInt(v)
+			if !ok {
+				fail(k, v, "number")
+				continue
+			}
+			c.Semantic = i != 0
+		case "fmt_on_save":
+			i, ok := toInt(v)
+			if !ok {
+				fail(k, v, "number")
+				continue
+			}
+			c.FmtOnSave = i != 0
+		case "imports_on_save":
+			i, ok := toInt(v)
+			if !ok {
+				fail(k, v, "number")
+				continue
+			}
+			c.ImportsOnSave = i != 0
+		case "local_prefix":
+			s, ok := v.(string)
+			if !ok {
+				fail(k, v, "string")
+				continue
+			}
+			c.LocalPrefix = s
+		case "tag_transform":
+			s, ok := v.(string)
+			if !ok {
+				fail(k, v, "string")
+				continue
+			}
+			if tagTransforms[s] == nil {
+				errs = append(errs, fmt.Sprintf("g:neogo_tag_transform: unknown transform %q", s))
+				continue
+			}
+			c.TagTransform = s
+		case "log_level":
+			s, ok := v.(string)
+			if !ok {
+				fail(k, v, "string")
+				continue
+			}
+			l, err := ParseLogLevel(s)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("g:neogo_log_level: %v", err))
+				continue
+			}
+			c.LogLevel = l
+		case "debug_ast":
+			i, ok := toInt(v)
+			if !ok {
+				fail(k, v, "number")
+				continue
+			}
+			c.DebugAST = i != 0
+		default:
+			errs = append(errs, fmt.Sprintf("g:neogo_%v: unknown setting", k))
+		}
+	}
+
+	if errs != nil {
+		return fmt.Errorf("%v", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// KnownFeature reports whether s is the name of a neogo feature
+func KnownFeature(s string) bool {
+	for _, f := range allFeatures {
+		if f == s {
+			return true
+		}
+	}
+	return false
+}
+
+func toInt(i interface{}) (int, bool) {
+	switch i := i.(type) {
+	case int64:
+		return int(i), true
+	case int:
+		return i, true
+	case uint64:
+		return int(i), true
+	default:
+		return 0, false
+	}
+}
+
+// loadConfig reads the g:neogo_* variables from Neovim and applies them on
+// top of the base configuration. On error the returned Config still has every
+// valid setting applied
+func (n *Neogo) loadConfig() (Config, error) {
+	res := DefaultConfig()
+	if n.Base != nil {
+		res = n.Base.copy()
+	}
+
+	varsI, err := n.c.Eval(`filter(copy(g:), 'v:key =~# "^neogo_"')`)
+	if err != nil {
+		return res, fmt.Errorf("could not read g:neogo_* variables: %v", err)
+	}
+
+	vars := make(map[string]interface{})
+	switch varsI := varsI.(type) {
+	case map[string]interface{}:
+		for k, v := range varsI {
+			vars[strings.TrimPrefix(k, "neogo_")] = v
+		}
+	case map[interface{}]interface{}:
+		for k, v := range varsI {
+			vars[strings.TrimPrefix(fmt.Sprint(k), "neogo_")] = v
+		}
+	}
+
+	err = res.apply(vars)
+	return res, err
+}
+
+// config returns the current configuration; safe for concurrent use
+func (n *Neogo) config() Config {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.cfg
+}
+
+func (n *Neogo) setConfig(c Config) {
+	n.mu.Lock()
+	n.cfg = c
+	n.mu.Unlock()
+}
+
+// ReloadConfig re-reads the g:neogo_* variables; exposed to Neovim as
+// NeogoReloadConfig and the :NeogoReloadConfig command
+func (n *Neogo) ReloadConfig(o *neovim.MethodOptionParams) error {
+	c, err := n.loadConfig()
+	n.setConfig(c)
+	if err != nil {
+		n.errorf("config: %v", err)
+		return err
+	}
+	n.infof("config reloaded")
+	n.BufferUpdate(nil)
+	return nil
+}
+
+func (n *Neogo) logf(l LogLevel, format string, args ...interface{}) {
+	if n.l == nil || l > n.config().LogLevel {
+		return
+	}
+	n.l.Printf("["+l.String()+"] "+format, args...)
+}
+
+func (n *Neogo) errorf(format string, args ...interface{}) { n.logf(LogError, format, args...) }
+func (n *Neogo) infof(format string, args ...interface{})  { n.logf(LogInfo, format, args...) }
+func (n *Neogo) debugf(format string, args ...interface{}) { n.logf(LogDebug, format, args...) }
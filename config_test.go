@@ -0,0 +1,54 @@
+package neogo
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type ConfigTest struct{}
+
+var _ = Suite(&ConfigTest{})
+
+func (t *ConfigTest) TestDefaults(c *C) {
+	cfg := DefaultConfig()
+	err := cfg.apply(nil)
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Enabled(FeatureHighlight), Equals, true)
+	c.Assert(cfg.Debounce, Equals, 50*time.Millisecond)
+	c.Assert(cfg.LogLevel, Equals, LogError)
+}
+
+func (t *ConfigTest) TestApply(c *C) {
+	cfg := DefaultConfig()
+	err := cfg.apply(map[string]interface{}{
+		"features":      []interface{}{},
+		"debounce":      int64(200),
+		"max_file_size": int64(0),
+		"semantic":      int64(1),
+		"fmt_on_save":   int64(1),
+		"log_level":     "debug",
+	})
+	c.Assert(err, IsNil)
+	c.Assert(cfg.Enabled(FeatureHighlight), Equals, false)
+	c.Assert(cfg.Debounce, Equals, 200*time.Millisecond)
+	c.Assert(cfg.MaxFileSize, Equals, 0)
+	c.Assert(cfg.Semantic, Equals, true)
+	c.Assert(cfg.FmtOnSave, Equals, true)
+	c.Assert(cfg.LogLevel, Equals, LogDebug)
+}
+
+func (t *ConfigTest) TestApplyErrors(c *C) {
+	cfg := DefaultConfig()
+	err := cfg.apply(map[string]interface{}{
+		"debounce":      "fast",
+		"log_level":     "loud",
+		"semantic":      int64(1),
+		"colour":        int64(1),
+		"tag_transform": "kebab",
+	})
+	c.Assert(err, ErrorMatches, `g:neogo_colour: unknown setting; g:neogo_debounce: expected non-negative number, got string; g:neogo_log_level: unknown log level "loud"; g:neogo_tag_transform: unknown transform "kebab"`)
+	c.Assert(cfg.TagTransform, Equals, "snakecase")
+	c.Assert(cfg.Debounce, Equals, 50*time.Millisecond)
+	c.Assert(cfg.Semantic, Equals, true)
+}
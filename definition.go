@@ -0,0 +1,57 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+
+	"github.com/myitcv/neovim"
+)
+
+// Definition jumps to the declaration of the identifier under the cursor;
+// exposed as NeogoDefinition and the :NeogoDefinition command
+func (n *Neogo) Definition(o *neovim.MethodOptionParams) error {
+	return n.report(n.definition())
+}
+
+func (n *Neogo) definition() error {
+	if err := n.requireFeature(FeatureDefinition); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	p, f, err := n.typeCheck(b)
+	if err != nil {
+		return err
+	}
+
+	pos := filePos(n.ldr.fset, f, b.offset(b.line, b.col))
+	id, obj := objectAt(p, f, pos)
+	if id == nil {
+		return fmt.Errorf("no identifier under cursor")
+	}
+	if obj == nil {
+		return fmt.Errorf("could not resolve %v", id.Name)
+	}
+	if !obj.Pos().IsValid() {
+		if obj.Parent() == types.Universe {
+			return fmt.Errorf("%v is predeclared", obj.Name())
+		}
+		return fmt.Errorf("no source position for %v", obj.Name())
+	}
+
+	return n.jumpTo(b.name, n.ldr.fset.Position(obj.Pos()))
+}
+
+// typeCheck type-checks the package containing b, using b's contents in place
+// of the file on disk, and returns it with b's AST
+func (n *Neogo) typeCheck(b *bufferState) (*pkgInfo, *ast.File, error) {
+	n.ldr.setOverlay(b.name, b.src())
+	return n.ldr.checkFile(b.name)
+}
@@ -0,0 +1,57 @@
+package neogo
+
+import (
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+)
+
+const definitionA = `package a
+
+import (
+	"fmt"
+
+	"example.com/p/b"
+)
+
+type T struct{ F int }
+
+func A() {
+	var t T
+	fmt.Println(b.B(), t.F, len("x"))
+}
+`
+
+func (t *PluginTest) TestDefinition(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": definitionA,
+		"b/b.go": "package b\n\n// B is in another package\nfunc B() int { return 1 }\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+
+	afn := filepath.Join(root, "a", "a.go")
+	bfn := filepath.Join(root, "b", "b.go")
+
+	check := func(line int, marker string, delta int, wantFn string, wantPos [2]int) {
+		t.nvim.setBuffer(afn, definitionA)
+		t.nvim.setCursor(line, marker, delta)
+		c.Assert(t.plug.Definition(nil), IsNil)
+		fn, cur := t.nvim.current()
+		c.Check(fn, Equals, wantFn, Commentf("%v", marker))
+		c.Check(cur, Equals, wantPos, Commentf("%v", marker))
+	}
+
+	// in another package, and so another file
+	check(13, "b.B()", 2, bfn, [2]int{4, 6})
+	// a field
+	check(13, "t.F", 2, afn, [2]int{9, 16})
+	// a type
+	check(12, "T", 0, afn, [2]int{9, 6})
+
+	// predeclared identifiers have no definition
+	t.nvim.setBuffer(afn, definitionA)
+	t.nvim.setCursor(13, "len", 0)
+	c.Assert(t.plug.Definition(nil), ErrorMatches, "len is predeclared")
+}
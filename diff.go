@@ -0,0 +1,116 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+// maxDiff bounds the edit distance lineDiff searches for; beyond it the
+// lines that differ are replaced in one edit
+const maxDiff = 1000
+
+// lineDiff returns the edits that turn the lines a into b, each replacing a
+// run of lines of a that is not in their longest common subsequence. Lines
+// in common are left alone, so that marks, folds and the cursor on them are
+// kept
+func lineDiff(a, b []string) []lineEdit {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	am, bm := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	if len(am) == 0 && len(bm) == 0 {
+		return nil
+	}
+
+	var res []lineEdit
+	i, j := 0, 0
+	for _, m := range append(commonLines(am, bm), [2]int{len(am), len(bm)}) {
+		if m[0] > i || m[1] > j {
+			res = append(res, lineEdit{
+				start: pre + i,
+				end:   pre + m[0],
+				lines: append([]string{}, bm[j:m[1]]...),
+			})
+		}
+		i, j = m[0]+1, m[1]+1
+	}
+	return res
+}
+
+// commonLines returns the indexes in a and b of the lines of a longest
+// common subsequence of the two, in order, found with Myers' algorithm. If
+// more than maxDiff lines differ it gives up and returns none
+func commonLines(a, b []string) [][2]int {
+	n, m := len(a), len(b)
+	dmax := n + m
+	if dmax > maxDiff {
+		dmax = maxDiff
+	}
+	off := dmax + 1
+	v := make([]int, 2*dmax+3)
+
+	// trace[d] holds v[off-d:off+d+1], the diagonals step d reads, as they
+	// were before step d; the whole of v is not kept for each step, so
+	// that memory grows with the differences alone
+	var trace [][]int
+	found := false
+	for d := 0; d <= dmax && !found; d++ {
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	var res [][2]int
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d]
+		k := x - y
+		var pk int
+		if k == -d || (k != d && prev[d+k-1] < prev[d+k+1]) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := prev[d+pk]
+		py := px - pk
+		for x > px && y > py {
+			x--
+			y--
+			res = append(res, [2]int{x, y})
+		}
+		x, y = px, py
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		res = append(res, [2]int{x, y})
+	}
+
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
@@ -0,0 +1,681 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/myitcv/neovim"
+)
+
+// ExtractFunc moves the statements on the lines of the last visual
+// selection into a new function called name, declared after the enclosing
+// one, and calls it in their place. Variables declared outside the
+// statements that they read become parameters; those declared or assigned
+// by them and used afterwards (or again, in a loop or function literal)
+// become results. Stores nothing sees afterwards become stores to _.
+// Statements that return, defer or jump out of
+// the selection cannot be extracted. Exposed as NeogoExtractFunc and
+// :NeogoExtractFunc {name}
+func (n *Neogo) ExtractFunc(o *neovim.MethodOptionParams, name string) error {
+	return n.report(n.extractFunc(name))
+}
+
+// ExtractVar declares a variable called name, before the statement that
+// contains it, holding the expression of the last visual selection, and
+// uses it in place of the expression. Exposed as NeogoExtractVar and
+// :NeogoExtractVar {name}
+func (n *Neogo) ExtractVar(o *neovim.MethodOptionParams, name string) error {
+	return n.report(n.extractVar(name))
+}
+
+// visualSelection returns the byte offsets in b of the start and end
+// (exclusive) of the last visual selection
+func (n *Neogo) visualSelection(b *bufferState) (int, int, error) {
+	resI, err := n.c.Eval(`[getpos("'<"), getpos("'>")]`)
+	if err != nil {
+		return 0, 0, err
+	}
+	// each of [bufnum, lnum, col, off]
+	var pos [2][2]int
+	l, _ := resI.([]interface{})
+	if len(l) != 2 {
+		return 0, 0, fmt.Errorf("unexpected visual selection %v", resI)
+	}
+	for i := range pos {
+		p, _ := l[i].([]interface{})
+		if len(p) < 3 {
+			return 0, 0, fmt.Errorf("unexpected visual selection %v", resI)
+		}
+		pos[i][0], _ = toInt(p[1])
+		pos[i][1], _ = toInt(p[2])
+	}
+	start, end := pos[0], pos[1]
+	if start[0] < 1 || end[0] < start[0] || end[0] > len(b.lines) {
+		return 0, 0, fmt.Errorf("no visual selection")
+	}
+	// linewise selections end at a huge column; otherwise the end is the
+	// first byte of the last character selected
+	last := b.lines[end[0]-1]
+	if end[1] > len(last) {
+		end[1] = len(last)
+	} else if end[1] > 0 {
+		_, size := utf8.DecodeRuneInString(last[end[1]-1:])
+		end[1] += size - 1
+	}
+	if start[1] < 1 {
+		start[1] = 1
+	}
+	return b.offset(start[0], start[1]), b.offset(end[0], end[1]) + 1, nil
+}
+
+// validName checks that name can be declared as a new identifier
+func validName(name string) error {
+	if !token.IsIdentifier(name) || name == "_" {
+		return fmt.Errorf("%q is not a valid name", name)
+	}
+	return nil
+}
+
+func (n *Neogo) extractFunc(name string) error {
+	if err := n.requireFeature(FeatureExtract); err != nil {
+		return err
+	}
+	if err := validName(name); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	start, end, err := n.visualSelection(b)
+	if err != nil {
+		return err
+	}
+	p, f, err := n.typeCheck(b)
+	if err != nil {
+		return err
+	}
+	fset := n.ldr.fset
+	tf := fset.File(f.Pos())
+	src := b.src()
+
+	// whole lines are extracted
+	l1, l2 := tf.Line(filePos(fset, f, start)), tf.Line(filePos(fset, f, end-1))
+	lo := tf.LineStart(l1)
+	hi := token.Pos(tf.Base() + tf.Size())
+	if l2 < tf.LineCount() {
+		hi = tf.LineStart(l2+1) - 1
+	}
+	stmts, err := selectedStmts(f, lo, hi)
+	if err != nil {
+		return err
+	}
+	first, last := stmts[0], stmts[len(stmts)-1]
+	for _, r := range [][2]token.Pos{{lo, first.Pos()}, {last.End(), hi}} {
+		for _, l := range strings.Split(string(src[tf.Offset(r[0]):tf.Offset(r[1])]), "\n") {
+			if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, "//") {
+				return fmt.Errorf("the selected lines must hold whole statements only")
+			}
+		}
+	}
+	if err := checkExtractable(stmts); err != nil {
+		return err
+	}
+
+	var decl *ast.FuncDecl
+	for _, nd := range enclosing(f, first.Pos()) {
+		if fd, ok := nd.(*ast.FuncDecl); ok {
+			decl = fd
+		}
+	}
+	if decl == nil {
+		return fmt.Errorf("the selection is not within a function")
+	}
+	if obj := p.pkg.Scope().Lookup(name); obj != nil {
+		return fmt.Errorf("%v is already declared in package %v", name, p.pkg.Name())
+	}
+	if types.Universe.Lookup(name) != nil {
+		return fmt.Errorf("%v would hide the predeclared %v", name, name)
+	}
+	if s := p.pkg.Scope().Innermost(first.Pos()); s != nil {
+		if _, obj := s.LookupParent(name, first.Pos()); obj != nil && obj.Parent() != types.Universe {
+			return fmt.Errorf("%v would be hidden by the %v declared at line %v", name, name, fset.Position(obj.Pos()).Line)
+		}
+	}
+
+	inside := func(pos token.Pos) bool { return first.Pos() <= pos && pos < last.End() }
+	local := func(obj types.Object) bool {
+		return obj != nil && obj.Pkg() == p.pkg && obj.Parent() != nil && obj.Parent() != p.pkg.Scope() && obj.Parent() != types.Universe
+	}
+	// the uses outside the selection that can see what it assigns: those
+	// after it, and those in a loop around it or in a function literal,
+	// which may run again after it
+	var again []ast.Node
+	for _, nd := range enclosing(f, first.Pos()) {
+		switch nd.(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			again = append(again, nd)
+		}
+	}
+	ast.Inspect(decl.Body, func(nd ast.Node) bool {
+		if fl, ok := nd.(*ast.FuncLit); ok {
+			again = append(again, fl)
+		}
+		return true
+	})
+	sees := func(pos token.Pos) bool {
+		if pos >= last.End() {
+			return true
+		}
+		for _, nd := range again {
+			if nd.Pos() <= pos && pos < nd.End() {
+				return true
+			}
+		}
+		return false
+	}
+	usedAfter := make(map[types.Object]bool)
+	for id, obj := range p.info.Uses {
+		if local(obj) && !inside(id.Pos()) && sees(id.Pos()) {
+			usedAfter[obj] = true
+		}
+	}
+
+	// the identifiers the selection only assigns to, with =; a variable
+	// from outside used only so is not a parameter
+	stores := make(map[*ast.Ident]bool)
+	for _, s := range stmts {
+		ast.Inspect(s, func(nd ast.Node) bool {
+			if as, ok := nd.(*ast.AssignStmt); ok && as.Tok == token.ASSIGN {
+				for _, e := range as.Lhs {
+					if id, ok := e.(*ast.Ident); ok {
+						stores[id] = true
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	var params, results, written []*types.Var
+	seen := make(map[types.Object]bool)
+	assigned := make(map[types.Object]bool)
+	defined := make(map[types.Object]bool)
+	var walkErr error
+	for _, s := range stmts {
+		ast.Inspect(s, func(nd ast.Node) bool {
+			switch nd := nd.(type) {
+			case *ast.AssignStmt:
+				for _, e := range nd.Lhs {
+					if id := rootIdent(e); id != nil {
+						if obj := p.info.Uses[id]; obj != nil {
+							assigned[obj] = true
+						}
+					}
+				}
+			case *ast.IncDecStmt:
+				if id := rootIdent(nd.X); id != nil {
+					assigned[p.info.Uses[id]] = true
+				}
+			case *ast.UnaryExpr:
+				if id := rootIdent(nd.X); nd.Op == token.AND && id != nil {
+					assigned[p.info.Uses[id]] = true
+				}
+			case *ast.SelectorExpr:
+				// a method with a pointer receiver called on a variable,
+				// not a pointer, takes its address too
+				if sel := p.info.Selections[nd]; sel != nil && sel.Kind() == types.MethodVal {
+					_, ptrRecv := sel.Obj().Type().(*types.Signature).Recv().Type().(*types.Pointer)
+					_, ptrX := p.info.TypeOf(nd.X).Underlying().(*types.Pointer)
+					if id := rootIdent(nd.X); ptrRecv && !ptrX && id != nil {
+						assigned[p.info.Uses[id]] = true
+					}
+				}
+			case *ast.Ident:
+				if obj := p.info.Defs[nd]; local(obj) && !seen[obj] {
+					if v, ok := obj.(*types.Var); ok && usedAfter[v] {
+						seen[obj] = true
+						defined[obj] = true
+						results = append(results, v)
+					}
+				}
+				obj := p.info.Uses[nd]
+				if !local(obj) || inside(obj.Pos()) || seen[obj] {
+					return true
+				}
+				switch obj := obj.(type) {
+				case *types.Var:
+					if obj.IsField() {
+						break
+					}
+					if stores[nd] {
+						written = append(written, obj)
+						break
+					}
+					seen[obj] = true
+					params = append(params, obj)
+				case *types.TypeName, *types.Const:
+					if walkErr == nil {
+						walkErr = fmt.Errorf("the selection uses %v, declared locally outside it", obj.Name())
+					}
+				}
+			}
+			return true
+		})
+	}
+	if walkErr != nil {
+		return walkErr
+	}
+	for _, v := range params {
+		if assigned[v] && usedAfter[v] {
+			results = append(results, v)
+		}
+	}
+	// of the variables only stored to, those used after are declared in the
+	// new function and returned; the stores to the others are dead, and
+	// become stores to _
+	var declared []*types.Var
+	storedOnly := make(map[types.Object]bool)
+	for _, v := range written {
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		storedOnly[v] = true
+		if usedAfter[v] {
+			declared = append(declared, v)
+			results = append(results, v)
+		}
+	}
+	var dead []*ast.Ident
+	for id := range stores {
+		if obj := p.info.Uses[id]; storedOnly[obj] && !usedAfter[obj] {
+			dead = append(dead, id)
+		}
+	}
+	// last first, so that the columns of the others stay valid
+	sort.Slice(dead, func(i, j int) bool { return dead[i].Pos() > dead[j].Pos() })
+
+	qual := fileQualifier(p, f)
+	var ps, rs, rnames, args []string
+	for _, v := range params {
+		ps = append(ps, v.Name()+" "+types.TypeString(v.Type(), qual))
+		args = append(args, v.Name())
+	}
+	for _, v := range results {
+		rs = append(rs, types.TypeString(v.Type(), qual))
+		rnames = append(rnames, v.Name())
+	}
+
+	// the new function
+	body := append([]string(nil), b.lines[l1-1:l2]...)
+	for _, id := range dead {
+		pos := fset.Position(id.Pos())
+		l := body[pos.Line-l1]
+		body[pos.Line-l1] = l[:pos.Column-1] + "_" + l[pos.Column-1+len(id.Name):]
+	}
+	indent := commonIndent(body)
+	fn := []string{"", "func " + name + "(" + strings.Join(ps, ", ") + ")" + resultList(rs) + " {"}
+	for _, v := range declared {
+		fn = append(fn, "\tvar "+v.Name()+" "+types.TypeString(v.Type(), qual))
+	}
+	for _, l := range body {
+		if strings.TrimSpace(l) == "" {
+			fn = append(fn, "")
+		} else {
+			fn = append(fn, "\t"+strings.TrimPrefix(l, indent))
+		}
+	}
+	if results != nil {
+		fn = append(fn, "\treturn "+strings.Join(rnames, ", "))
+	}
+	fn = append(fn, "}")
+
+	// the call
+	lead := b.lines[l1-1][:len(b.lines[l1-1])-len(strings.TrimLeft(b.lines[l1-1], " \t"))]
+	call := name + "(" + strings.Join(args, ", ") + ")"
+	var calls []string
+	switch {
+	case results == nil:
+		calls = []string{lead + call}
+	case len(defined) == len(results):
+		calls = []string{lead + strings.Join(rnames, ", ") + " := " + call}
+	default:
+		for _, v := range results {
+			if defined[v] {
+				calls = append(calls, lead+"var "+v.Name()+" "+types.TypeString(v.Type(), qual))
+			}
+		}
+		calls = append(calls, lead+strings.Join(rnames, ", ")+" = "+call)
+	}
+
+	at := tf.Line(decl.End())
+	return n.applyEdits([]lineEdit{
+		{start: l1 - 1, end: l2, lines: calls},
+		{start: at, end: at, lines: fn},
+	})
+}
+
+// selectedStmts returns the statements of a statement list that lie within
+// [lo, hi]: those of the outermost list with any, which must have none that
+// only overlap it
+func selectedStmts(f *ast.File, lo, hi token.Pos) ([]ast.Stmt, error) {
+	var res []ast.Stmt
+	var err error
+	ast.Inspect(f, func(nd ast.Node) bool {
+		if res != nil || err != nil || nd == nil || nd.End() < lo || nd.Pos() > hi {
+			return false
+		}
+		var list []ast.Stmt
+		switch nd := nd.(type) {
+		case *ast.BlockStmt:
+			list = nd.List
+		case *ast.CaseClause:
+			list = nd.Body
+		case *ast.CommClause:
+			list = nd.Body
+		default:
+			return true
+		}
+		partial := false
+		for _, s := range list {
+			switch {
+			case lo <= s.Pos() && s.End() <= hi:
+				res = append(res, s)
+			case s.Pos() < hi && lo < s.End():
+				partial = true
+			}
+		}
+		if res != nil && partial {
+			res, err = nil, fmt.Errorf("the selection must consist of whole statements")
+		}
+		return res == nil
+	})
+	if err == nil && res == nil {
+		err = fmt.Errorf("no statements selected")
+	}
+	return res, err
+}
+
+// checkExtractable fails if stmts cannot be moved into a function of their
+// own: if they return, defer, or branch to outside themselves
+func checkExtractable(stmts []ast.Stmt) error {
+	var err error
+	var stack []ast.Node
+	for _, s := range stmts {
+		ast.Inspect(s, func(nd ast.Node) bool {
+			if nd == nil {
+				stack = stack[:len(stack)-1]
+				return false
+			}
+			if err != nil {
+				return false
+			}
+			switch nd := nd.(type) {
+			case *ast.FuncLit:
+				// anything goes inside
+				return false
+			case *ast.ReturnStmt:
+				err = fmt.Errorf("cannot extract statements that return")
+			case *ast.DeferStmt:
+				err = fmt.Errorf("cannot extract statements that defer")
+			case *ast.LabeledStmt:
+				err = fmt.Errorf("cannot extract labeled statements")
+			case *ast.BranchStmt:
+				if nd.Label != nil || nd.Tok == token.GOTO || !withinTarget(stack, nd.Tok) {
+					err = fmt.Errorf("cannot extract a %v out of the selection", nd.Tok)
+				}
+			}
+			stack = append(stack, nd)
+			return true
+		})
+	}
+	return err
+}
+
+// withinTarget reports whether stack holds the statement an unlabeled
+// branch of kind tok applies to
+func withinTarget(stack []ast.Node, tok token.Token) bool {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch stack[i].(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			return tok == token.BREAK || tok == token.CONTINUE
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			if tok == token.BREAK || tok == token.FALLTHROUGH {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rootIdent returns the variable at the root of e, as in x, x.f, x[i] or
+// (*x).f, or nil
+func rootIdent(e ast.Expr) *ast.Ident {
+	for {
+		switch x := e.(type) {
+		case *ast.Ident:
+			return x
+		case *ast.SelectorExpr:
+			e = x.X
+		case *ast.IndexExpr:
+			e = x.X
+		case *ast.StarExpr:
+			e = x.X
+		case *ast.ParenExpr:
+			e = x.X
+		default:
+			return nil
+		}
+	}
+}
+
+// commonIndent returns the leading white space shared by the non-blank
+// lines
+func commonIndent(lines []string) string {
+	var res string
+	first := true
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		ind := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+		if first {
+			res, first = ind, false
+			continue
+		}
+		for !strings.HasPrefix(ind, res) {
+			res = res[:len(res)-1]
+		}
+	}
+	return res
+}
+
+// resultList formats the result types of a function signature
+func resultList(rs []string) string {
+	switch len(rs) {
+	case 0:
+		return ""
+	case 1:
+		return " " + rs[0]
+	}
+	return " (" + strings.Join(rs, ", ") + ")"
+}
+
+func (n *Neogo) extractVar(name string) error {
+	if err := n.requireFeature(FeatureExtract); err != nil {
+		return err
+	}
+	if err := validName(name); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	start, end, err := n.visualSelection(b)
+	if err != nil {
+		return err
+	}
+	src := b.src()
+	for start < end && isSpace(src[start]) {
+		start++
+	}
+	for end > start && isSpace(src[end-1]) {
+		end--
+	}
+	p, f, err := n.typeCheck(b)
+	if err != nil {
+		return err
+	}
+	fset := n.ldr.fset
+	tf := fset.File(f.Pos())
+	lo, hi := filePos(fset, f, start), filePos(fset, f, end)
+
+	// the expression selected, and the path from it to the statement of a
+	// statement list that contains it
+	var expr ast.Expr
+	var path []ast.Node
+	var stmt ast.Stmt
+	var block ast.Node
+	for _, nd := range enclosing(f, lo) {
+		if e, ok := nd.(ast.Expr); ok && expr == nil && e.Pos() == lo && e.End() == hi {
+			expr = e
+		}
+		if expr == nil {
+			continue
+		}
+		var list []ast.Stmt
+		switch nd := nd.(type) {
+		case *ast.BlockStmt:
+			list = nd.List
+		case *ast.CaseClause:
+			list = nd.Body
+		case *ast.CommClause:
+			list = nd.Body
+		}
+		for _, s := range list {
+			if s == path[len(path)-1] {
+				stmt, block = s, nd
+			}
+		}
+		if stmt != nil {
+			break
+		}
+		path = append(path, nd)
+	}
+	if expr == nil {
+		return fmt.Errorf("the selection is not an expression")
+	}
+	if stmt == nil {
+		return fmt.Errorf("the expression is not within a function body")
+	}
+	path = append(path, stmt)
+	tv, ok := p.info.Types[expr]
+	if !ok || !tv.IsValue() {
+		return fmt.Errorf("the selection is not a value")
+	}
+	if isUntyped(tv.Type) {
+		return fmt.Errorf("the expression is untyped here, so has no type to declare")
+	}
+	// an expression untyped on its own, such as 5 in 5 * time.Second, takes
+	// its type from where it is; := would give it its default type instead
+	var typ string
+	alone := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+	if err := types.CheckExpr(fset, p.pkg, expr.Pos(), expr, alone); err == nil {
+		if t := alone.Types[expr].Type; isUntyped(t) && !types.Identical(types.Default(t), tv.Type) {
+			typ = types.TypeString(tv.Type, fileQualifier(p, f))
+		}
+	}
+
+	// the expression must be evaluated once, where the variable is declared
+	for i := 1; i < len(path); i++ {
+		child := path[i-1]
+		switch nd := path[i].(type) {
+		case *ast.AssignStmt:
+			for _, l := range nd.Lhs {
+				if l == child {
+					return fmt.Errorf("cannot extract what is assigned to")
+				}
+			}
+		case *ast.IncDecStmt:
+			return fmt.Errorf("cannot extract what is assigned to")
+		case *ast.UnaryExpr:
+			if nd.Op == token.AND {
+				return fmt.Errorf("cannot extract what has its address taken")
+			}
+		case *ast.BinaryExpr:
+			if (nd.Op == token.LAND || nd.Op == token.LOR) && child == nd.Y {
+				return fmt.Errorf("the expression is not always evaluated")
+			}
+		case *ast.FuncLit, *ast.CaseClause, *ast.CommClause:
+			return fmt.Errorf("the expression is not evaluated where it would be declared")
+		case *ast.ForStmt:
+			if child != nd.Init {
+				return fmt.Errorf("the expression is evaluated on each iteration")
+			}
+		case *ast.IfStmt:
+			if nd != stmt {
+				return fmt.Errorf("the expression is not always evaluated")
+			}
+		}
+	}
+
+	line := tf.Line(stmt.Pos())
+	at := tf.LineStart(line)
+	var walkErr error
+	ast.Inspect(expr, func(nd ast.Node) bool {
+		if id, ok := nd.(*ast.Ident); ok && walkErr == nil {
+			if obj := p.info.Uses[id]; obj != nil && obj.Pos() >= at && obj.Pos() < stmt.End() {
+				walkErr = fmt.Errorf("the expression uses %v, declared by the statement", id.Name)
+			}
+		}
+		return true
+	})
+	if walkErr != nil {
+		return walkErr
+	}
+	if s := p.pkg.Scope().Innermost(stmt.Pos()); s != nil {
+		if inner, obj := s.LookupParent(name, stmt.Pos()); obj != nil {
+			if inner == s {
+				return fmt.Errorf("%v is already declared in this block", name)
+			}
+			for id, o := range p.info.Uses {
+				if o == obj && id.Pos() >= stmt.Pos() && id.Pos() < block.End() {
+					return fmt.Errorf("%v would hide the %v used at line %v", name, name, tf.Line(id.Pos()))
+				}
+			}
+		}
+	}
+
+	l2 := tf.Line(hi)
+	text := strings.Join(b.lines[line-1:l2], "\n")
+	rel := tf.Offset(lo) - tf.Offset(at)
+	text = text[:rel] + name + text[rel+(end-start):]
+	lead := b.lines[line-1][:len(b.lines[line-1])-len(strings.TrimLeft(b.lines[line-1], " \t"))]
+	decl := lead + name + " := "
+	if typ != "" {
+		decl = lead + "var " + name + " " + typ + " = "
+	}
+	decls := strings.Split(decl+string(src[start:end]), "\n")
+	return n.applyEdits([]lineEdit{{start: line - 1, end: l2, lines: append(decls, strings.Split(text, "\n")...)}})
+}
+
+// isUntyped reports whether t is the type of an untyped constant, bool or nil
+func isUntyped(t types.Type) bool {
+	b, ok := t.(*types.Basic)
+	return ok && b.Info()&types.IsUntyped != 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
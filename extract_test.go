@@ -0,0 +1,248 @@
+package neogo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+const extractTestSrc = `package a
+
+import "strings"
+
+func f(s string) int {
+	n := 0
+	prefix := "x"
+	// count
+	for _, w := range strings.Fields(s) {
+		if strings.HasPrefix(w, prefix) {
+			n++
+		}
+	}
+	total := n * 2
+	return total + len(prefix)
+}`
+
+func (t *PluginTest) TestExtractFunc(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": extractTestSrc + "\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+	afn := filepath.Join(root, "a", "a.go")
+
+	var sel [4]int
+	t.nvim.handleEval(`^\[getpos\(`, func(m []string) (interface{}, error) {
+		return []interface{}{
+			[]interface{}{int64(0), int64(sel[0]), int64(sel[1]), int64(0)},
+			[]interface{}{int64(0), int64(sel[2]), int64(sel[3]), int64(0)},
+		}, nil
+	})
+	extract := func(l1, l2 int, name string) (string, error) {
+		t.nvim.setBuffer(afn, extractTestSrc)
+		sel = [4]int{l1, 1, l2, 2147483647}
+		err := t.plug.ExtractFunc(nil, name)
+		return strings.Join(t.nvim.bufferLines(), "\n"), err
+	}
+
+	res, err := extract(8, 13, "count")
+	c.Assert(err, IsNil)
+	c.Assert(res, Equals, `package a
+
+import "strings"
+
+func f(s string) int {
+	n := 0
+	prefix := "x"
+	n = count(s, prefix, n)
+	total := n * 2
+	return total + len(prefix)
+}
+
+func count(s string, prefix string, n int) int {
+	// count
+	for _, w := range strings.Fields(s) {
+		if strings.HasPrefix(w, prefix) {
+			n++
+		}
+	}
+	return n
+}`)
+
+	res, err = extract(6, 7, "initial")
+	c.Assert(err, IsNil)
+	c.Assert(strings.Split(res, "\n")[5], Equals, "\tn, prefix := initial()")
+	c.Assert(res, Matches, `(?s).*
+func initial\(\) \(int, string\) {
+	n := 0
+	prefix := "x"
+	return n, prefix
+}`)
+
+	_, err = extract(11, 11, "inc")
+	c.Assert(err, IsNil)
+
+	_, err = extract(15, 15, "g")
+	c.Assert(err, ErrorMatches, "cannot extract statements that return")
+	_, err = extract(10, 11, "g")
+	c.Assert(err, ErrorMatches, "the selected lines must hold whole statements only")
+	_, err = extract(6, 7, "f")
+	c.Assert(err, ErrorMatches, "f is already declared in package a")
+	_, err = extract(6, 7, "s")
+	c.Assert(err, ErrorMatches, "s would be hidden by the s declared at line 5")
+}
+
+func (t *PluginTest) TestExtractVar(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": extractTestSrc + "\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+	afn := filepath.Join(root, "a", "a.go")
+
+	var sel [4]int
+	t.nvim.handleEval(`^\[getpos\(`, func(m []string) (interface{}, error) {
+		return []interface{}{
+			[]interface{}{int64(0), int64(sel[0]), int64(sel[1]), int64(0)},
+			[]interface{}{int64(0), int64(sel[2]), int64(sel[3]), int64(0)},
+		}, nil
+	})
+	// extract selects text on line of src, from the start of marker for n bytes
+	src := extractTestSrc
+	extract := func(line int, marker string, n int, name string) ([]string, error) {
+		t.nvim.setBuffer(afn, src)
+		col := strings.Index(strings.Split(src, "\n")[line-1], marker) + 1
+		sel = [4]int{line, col, line, col + n - 1}
+		err := t.plug.ExtractVar(nil, name)
+		return t.nvim.bufferLines(), err
+	}
+
+	lines, err := extract(14, "n * 2", 5, "double")
+	c.Assert(err, IsNil)
+	c.Assert(lines[13:15], DeepEquals, []string{"\tdouble := n * 2", "\ttotal := double"})
+
+	lines, err = extract(10, "strings.", len("strings.HasPrefix(w, prefix)"), "ok")
+	c.Assert(err, IsNil)
+	c.Assert(lines[9:11], DeepEquals, []string{"\t\tok := strings.HasPrefix(w, prefix)", "\t\tif ok {"})
+
+	lines, err = extract(9, "strings.", len("strings.Fields(s)"), "words")
+	c.Assert(err, IsNil)
+	c.Assert(lines[8:10], DeepEquals, []string{"\twords := strings.Fields(s)", "\tfor _, w := range words {"})
+
+	_, err = extract(14, "n * 2", 5, "n")
+	c.Assert(err, ErrorMatches, "n is already declared in this block")
+	_, err = extract(14, "n * 2", 3, "x")
+	c.Assert(err, ErrorMatches, "the selection is not an expression")
+	_, err = extract(11, "n++", 1, "x")
+	c.Assert(err, ErrorMatches, "cannot extract what is assigned to")
+
+	// an untyped constant keeps the type it has where it is
+	src = extractUntypedTestSrc
+	lines, err = extract(7, "5", 1, "n")
+	c.Assert(err, IsNil)
+	c.Assert(lines[6:8], DeepEquals, []string{"\tvar n time.Duration = 5", "\td := n * time.Second"})
+	lines, err = extract(8, "d * c", 5, "x")
+	c.Assert(err, IsNil)
+	c.Assert(lines[7:9], DeepEquals, []string{"\tx := d * c", "\treturn x"})
+	_, err = extract(6, "1 << 3", 6, "x")
+	c.Assert(err, ErrorMatches, "the expression is untyped here, so has no type to declare")
+}
+
+const extractUntypedTestSrc = `package a
+
+import "time"
+
+func f() time.Duration {
+	const c = 1 << 3
+	d := 5 * time.Second
+	return d * c
+}`
+
+const extractStoresTestSrc = `package a
+
+func f() int {
+	x := 1
+	println(x)
+	x = 2
+	y := 0
+	y = 3
+	z := 0
+	for i := 0; i < 2; i++ {
+		println(z)
+		z = i
+	}
+	return y
+}`
+
+func (t *PluginTest) TestExtractFuncStores(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": extractStoresTestSrc + "\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+	afn := filepath.Join(root, "a", "a.go")
+
+	var sel [4]int
+	t.nvim.handleEval(`^\[getpos\(`, func(m []string) (interface{}, error) {
+		return []interface{}{
+			[]interface{}{int64(0), int64(sel[0]), int64(sel[1]), int64(0)},
+			[]interface{}{int64(0), int64(sel[2]), int64(sel[3]), int64(0)},
+		}, nil
+	})
+	extract := func(line int) []string {
+		t.nvim.setBuffer(afn, extractStoresTestSrc)
+		sel = [4]int{line, 1, line, 2147483647}
+		c.Assert(t.plug.ExtractFunc(nil, "g"), IsNil)
+		return t.nvim.bufferLines()
+	}
+
+	// a store that nothing after sees is neither parameter nor result
+	lines := extract(6)
+	c.Assert(lines[5], Equals, "\tg()")
+	c.Assert(strings.Join(lines[15:], "\n"), Equals, "\nfunc g() {\n\t_ = 2\n}")
+
+	// one that is seen is declared in the new function and returned
+	lines = extract(8)
+	c.Assert(lines[7], Equals, "\ty = g()")
+	c.Assert(strings.Join(lines[15:], "\n"), Equals, "\nfunc g() int {\n\tvar y int\n\ty = 3\n\treturn y\n}")
+
+	// as is one seen by the next time round a loop
+	lines = extract(12)
+	c.Assert(lines[11], Equals, "\t\tz = g(i)")
+	c.Assert(strings.Join(lines[15:], "\n"), Equals, "\nfunc g(i int) int {\n\tvar z int\n\tz = i\n\treturn z\n}")
+}
+
+const extractMethodTestSrc = `package a
+
+import "bytes"
+
+func f() string {
+	var buf bytes.Buffer
+	buf.WriteString("x")
+	return buf.String()
+}`
+
+func (t *PluginTest) TestExtractFuncPointerMethod(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": extractMethodTestSrc + "\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+	afn := filepath.Join(root, "a", "a.go")
+
+	t.nvim.handleEval(`^\[getpos\(`, func(m []string) (interface{}, error) {
+		return []interface{}{
+			[]interface{}{int64(0), int64(7), int64(1), int64(0)},
+			[]interface{}{int64(0), int64(7), int64(2147483647), int64(0)},
+		}, nil
+	})
+	t.nvim.setBuffer(afn, extractMethodTestSrc)
+	c.Assert(t.plug.ExtractFunc(nil, "w"), IsNil)
+
+	// WriteString takes the address of buf, so what it writes is returned
+	lines := t.nvim.bufferLines()
+	c.Assert(lines[6], Equals, "\tbuf = w(buf)")
+	c.Assert(strings.Join(lines[9:], "\n"), Equals, "\nfunc w(buf bytes.Buffer) bytes.Buffer {\n\tbuf.WriteString(\"x\")\n\treturn buf\n}")
+}
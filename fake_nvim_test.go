@@ -0,0 +1,711 @@
+package neogo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// fakeNvim is an in-process stand-in for Neovim that speaks msgpack-rpc over
+// a Unix socket. It implements only the handful of API methods (and eval
+// expressions) that neogo uses, keeps just enough state to answer them, and
+// records every call so that tests can assert on what the plugin did.
+type fakeNvim struct {
+	dir  string
+	addr string
+	l    net.Listener
+
+	mu      sync.Mutex
+	calls   []fakeCall
+	buffers map[int64]*fakeBuffer
+	curBuf  int64
+	vars    map[string]interface{}
+	view    fakeView
+
+	// cursor is the 1-based line and byte column of the cursor in the
+	// current buffer
+	cursor [2]int
+
+	matches   map[uint64]Span
+	lastMatch uint64
+
+	namespaces map[string]int64
+	highlights []fakeHighlight
+
+	// evals are consulted in order for vim_eval expressions the fake does
+	// not otherwise understand; tests add to them for feature-specific
+	// expressions
+	evals []fakeEval
+}
+
+type fakeCall struct {
+	Method string
+	Args   []interface{}
+}
+
+type fakeBuffer struct {
+	name  string
+	lines []string
+}
+
+type fakeView struct {
+	topline, height, leftcol, width int
+}
+
+type fakeHighlight struct {
+	buf, ns          int64
+	group            string
+	line, start, end int
+}
+
+type fakeEval struct {
+	re *regexp.Regexp
+	fn func(m []string) (interface{}, error)
+}
+
+// the ext type Neovim uses for Buffer handles
+const fakeBufferExt = 0
+
+func newFakeNvim() (*fakeNvim, error) {
+	dir, err := ioutil.TempDir("", "neogo-fake-nvim")
+	if err != nil {
+		return nil, err
+	}
+	addr := filepath.Join(dir, "sock")
+	l, err := net.Listen("unix", addr)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	res := &fakeNvim{
+		dir:        dir,
+		addr:       addr,
+		l:          l,
+		buffers:    map[int64]*fakeBuffer{1: {lines: []string{""}}},
+		curBuf:     1,
+		vars:       make(map[string]interface{}),
+		view:       fakeView{topline: 1, height: 50, leftcol: 0, width: 80},
+		cursor:     [2]int{1, 1},
+		matches:    make(map[uint64]Span),
+		namespaces: make(map[string]int64),
+	}
+
+	go res.accept()
+
+	return res, nil
+}
+
+func (f *fakeNvim) Close() error {
+	err := f.l.Close()
+	os.RemoveAll(f.dir)
+	return err
+}
+
+func (f *fakeNvim) accept() {
+	for {
+		conn, err := f.l.Accept()
+		if err != nil {
+			return
+		}
+		go f.serve(conn)
+	}
+}
+
+func (f *fakeNvim) serve(conn net.Conn) {
+	defer conn.Close()
+
+	dec := msgp.NewReader(conn)
+	enc := msgp.NewWriter(conn)
+
+	for {
+		sz, err := dec.ReadArrayHeader()
+		if err != nil {
+			return
+		}
+		kind, err := dec.ReadInt()
+		if err != nil {
+			return
+		}
+
+		switch {
+		case kind == 0 && sz == 4:
+			id, err := dec.ReadUint32()
+			if err != nil {
+				return
+			}
+			method, args, err := readCall(dec)
+			if err != nil {
+				return
+			}
+			res, cerr := f.call(method, args)
+
+			enc.WriteArrayHeader(4)
+			enc.WriteInt(1)
+			enc.WriteUint32(id)
+			if cerr != nil {
+				enc.WriteArrayHeader(2)
+				enc.WriteInt(0)
+				enc.WriteString(cerr.Error())
+				enc.WriteNil()
+			} else {
+				enc.WriteNil()
+				writeValue(enc, res)
+			}
+			if err := enc.Flush(); err != nil {
+				return
+			}
+		case kind == 2 && sz == 3:
+			method, args, err := readCall(dec)
+			if err != nil {
+				return
+			}
+			f.call(method, args)
+		default:
+			// responses to requests we never make, or garbage
+			for i := uint32(1); i < sz; i++ {
+				if err := dec.Skip(); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func readCall(dec *msgp.Reader) (string, []interface{}, error) {
+	method, err := dec.ReadString()
+	if err != nil {
+		return "", nil, err
+	}
+	argsI, err := dec.ReadIntf()
+	if err != nil {
+		return "", nil, err
+	}
+	args, _ := argsI.([]interface{})
+	return method, args, nil
+}
+
+// writeValue writes the subset of Go values the fake returns as results
+func writeValue(enc *msgp.Writer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		return enc.WriteNil()
+	case bool:
+		return enc.WriteBool(v)
+	case int:
+		return enc.WriteInt64(int64(v))
+	case int64:
+		return enc.WriteInt64(v)
+	case uint64:
+		return enc.WriteUint64(v)
+	case string:
+		return enc.WriteString(v)
+	case fakeBufferHandle:
+		return enc.WriteExtension(&msgp.RawExtension{Type: fakeBufferExt, Data: msgp.AppendInt64(nil, int64(v))})
+	case []string:
+		enc.WriteArrayHeader(uint32(len(v)))
+		for _, s := range v {
+			enc.WriteString(s)
+		}
+	case []interface{}:
+		enc.WriteArrayHeader(uint32(len(v)))
+		for _, e := range v {
+			writeValue(enc, e)
+		}
+	case map[string]interface{}:
+		enc.WriteMapHeader(uint32(len(v)))
+		for k, e := range v {
+			enc.WriteString(k)
+			writeValue(enc, e)
+		}
+	default:
+		return enc.WriteIntf(v)
+	}
+	return nil
+}
+
+type fakeBufferHandle int64
+
+func argBuffer(i interface{}) (int64, error) {
+	switch i := i.(type) {
+	case *msgp.RawExtension:
+		h, _, err := msgp.ReadInt64Bytes(i.Data)
+		return h, err
+	}
+	if h, ok := toInt(i); ok {
+		return int64(h), nil
+	}
+	return 0, fmt.Errorf("expected a buffer, got %T", i)
+}
+
+func argInt(i interface{}) (int, error) {
+	if v, ok := toInt(i); ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("expected a number, got %T", i)
+}
+
+func argStrings(i interface{}) []string {
+	var res []string
+	if l, ok := i.([]interface{}); ok {
+		for _, s := range l {
+			res = append(res, fmt.Sprint(s))
+		}
+	}
+	return res
+}
+
+// call dispatches a single API method. Both the original vim_/buffer_ names
+// and their nvim_ successors are accepted
+func (f *fakeNvim) call(method string, args []interface{}) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, fakeCall{Method: method, Args: args})
+
+	need := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("%v: expected %v arguments, got %v", method, n, len(args))
+		}
+		return nil
+	}
+
+	switch method {
+	case "vim_get_api_info", "nvim_get_api_info":
+		return []interface{}{int64(1), map[string]interface{}{}}, nil
+
+	case "vim_get_current_buffer", "nvim_get_current_buf":
+		return fakeBufferHandle(f.curBuf), nil
+
+	case "buffer_get_name", "nvim_buf_get_name":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		b, err := f.buffer(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return b.name, nil
+
+	case "buffer_get_line_slice":
+		if err := need(5); err != nil {
+			return nil, err
+		}
+		b, err := f.buffer(args[0])
+		if err != nil {
+			return nil, err
+		}
+		lo, hi, err := sliceRange(len(b.lines), args[1], args[2], args[3], args[4])
+		if err != nil {
+			return nil, err
+		}
+		return append([]string(nil), b.lines[lo:hi]...), nil
+
+	case "buffer_set_line_slice":
+		if err := need(6); err != nil {
+			return nil, err
+		}
+		b, err := f.buffer(args[0])
+		if err != nil {
+			return nil, err
+		}
+		lo, hi, err := sliceRange(len(b.lines), args[1], args[2], args[3], args[4])
+		if err != nil {
+			return nil, err
+		}
+		b.setLines(lo, hi, argStrings(args[5]))
+		return nil, nil
+
+	case "nvim_buf_get_lines":
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		b, err := f.buffer(args[0])
+		if err != nil {
+			return nil, err
+		}
+		lo, hi, err := sliceRange(len(b.lines), args[1], args[2], true, false)
+		if err != nil {
+			return nil, err
+		}
+		return append([]string(nil), b.lines[lo:hi]...), nil
+
+	case "nvim_buf_set_lines":
+		if err := need(5); err != nil {
+			return nil, err
+		}
+		b, err := f.buffer(args[0])
+		if err != nil {
+			return nil, err
+		}
+		lo, hi, err := sliceRange(len(b.lines), args[1], args[2], true, false)
+		if err != nil {
+			return nil, err
+		}
+		b.setLines(lo, hi, argStrings(args[4]))
+		return nil, nil
+
+	case "vim_command", "nvim_command":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		return nil, f.command(fmt.Sprint(args[0]))
+
+	case "vim_eval", "nvim_eval":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		return f.eval(fmt.Sprint(args[0]))
+
+	case "nvim_create_namespace":
+		if err := need(1); err != nil {
+			return nil, err
+		}
+		name := fmt.Sprint(args[0])
+		if id, ok := f.namespaces[name]; ok && name != "" {
+			return id, nil
+		}
+		id := int64(len(f.namespaces) + 1)
+		f.namespaces[name] = id
+		return id, nil
+
+	case "buffer_add_highlight", "nvim_buf_add_highlight":
+		if err := need(6); err != nil {
+			return nil, err
+		}
+		b, err := argBuffer(args[0])
+		if err != nil {
+			return nil, err
+		}
+		ns, err := argInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+		line, err := argInt(args[3])
+		if err != nil {
+			return nil, err
+		}
+		start, err := argInt(args[4])
+		if err != nil {
+			return nil, err
+		}
+		end, err := argInt(args[5])
+		if err != nil {
+			return nil, err
+		}
+		f.highlights = append(f.highlights, fakeHighlight{
+			buf: b, ns: int64(ns), group: fmt.Sprint(args[2]), line: line, start: start, end: end,
+		})
+		return int64(ns), nil
+
+	case "buffer_clear_highlight", "nvim_buf_clear_namespace":
+		if err := need(4); err != nil {
+			return nil, err
+		}
+		b, err := argBuffer(args[0])
+		if err != nil {
+			return nil, err
+		}
+		ns, _ := argInt(args[1])
+		start, _ := argInt(args[2])
+		end, _ := argInt(args[3])
+		var keep []fakeHighlight
+		for _, h := range f.highlights {
+			if h.buf == b && (ns < 0 || h.ns == int64(ns)) && h.line >= start && (end < 0 || h.line < end) {
+				continue
+			}
+			keep = append(keep, h)
+		}
+		f.highlights = keep
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("fake nvim: method %v not implemented", method)
+}
+
+func (f *fakeNvim) buffer(i interface{}) (*fakeBuffer, error) {
+	h, err := argBuffer(i)
+	if err != nil {
+		return nil, err
+	}
+	b, ok := f.buffers[h]
+	if !ok {
+		return nil, fmt.Errorf("invalid buffer %v", h)
+	}
+	return b, nil
+}
+
+func (b *fakeBuffer) setLines(lo, hi int, repl []string) {
+	lines := append([]string(nil), b.lines[:lo]...)
+	lines = append(lines, repl...)
+	b.lines = append(lines, b.lines[hi:]...)
+	if len(b.lines) == 0 {
+		b.lines = []string{""}
+	}
+}
+
+// sliceRange converts Neovim's line slice arguments, where negative indices
+// count back from the last line, to a Go slice range
+func sliceRange(n int, start, end, incStart, incEnd interface{}) (int, int, error) {
+	s, err := argInt(start)
+	if err != nil {
+		return 0, 0, err
+	}
+	e, err := argInt(end)
+	if err != nil {
+		return 0, 0, err
+	}
+	if s < 0 {
+		s += n
+	}
+	if e < 0 {
+		e += n
+	}
+	if b, _ := incStart.(bool); !b {
+		s++
+	}
+	if b, _ := incEnd.(bool); b {
+		e++
+	}
+	if s < 0 || e > n || s > e {
+		return 0, 0, fmt.Errorf("index out of bounds")
+	}
+	return s, e, nil
+}
+
+var (
+	fakeMatchAddPos = regexp.MustCompile(`^matchaddpos\('(\w+)', \[\[(\d+),(\d+),(\d+)\]\]\)$`)
+	fakeMatchDelete = regexp.MustCompile(`^matchdelete\((\d+)\)$`)
+
+	fakeCursor = regexp.MustCompile(`^call cursor\((\d+), (\d+)\)$`)
+	fakeEdit   = regexp.MustCompile(`^execute 'edit' fnameescape\('((?:[^']|'')*)'\)$`)
+
+	fakeGetBufLine  = regexp.MustCompile(`^getbufline\((\d+), 1, '\$'\)$`)
+	fakeBufSetLines = regexp.MustCompile(`^call nvim_buf_set_lines\((\d+), (\d+), (\d+), v:true, \[(.*)\]\)$`)
+	fakeVimString   = regexp.MustCompile(`'((?:[^']|'')*)'`)
+)
+
+// command understands the few commands that change state the fake tracks;
+// all others are only recorded. Called with f.mu held
+func (f *fakeNvim) command(cmd string) error {
+	if m := fakeCursor.FindStringSubmatch(cmd); m != nil {
+		f.cursor[0], _ = strconv.Atoi(m[1])
+		f.cursor[1], _ = strconv.Atoi(m[2])
+		return nil
+	}
+	if m := fakeBufSetLines.FindStringSubmatch(cmd); m != nil {
+		h, _ := strconv.ParseInt(m[1], 10, 64)
+		b, ok := f.buffers[h]
+		if !ok {
+			return fmt.Errorf("E158: Invalid buffer name: %v", h)
+		}
+		lo, _ := strconv.Atoi(m[2])
+		hi, _ := strconv.Atoi(m[3])
+		var repl []string
+		for _, s := range fakeVimString.FindAllStringSubmatch(m[4], -1) {
+			repl = append(repl, strings.Replace(s[1], "''", "'", -1))
+		}
+		b.setLines(lo, hi, repl)
+		return nil
+	}
+	if m := fakeEdit.FindStringSubmatch(cmd); m != nil {
+		fn := strings.Replace(m[1], "''", "'", -1)
+		for h, b := range f.buffers {
+			if b.name == fn {
+				f.curBuf = h
+				return nil
+			}
+		}
+		src, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return fmt.Errorf("E484: Can't open file %v", fn)
+		}
+		h := int64(len(f.buffers) + 1)
+		f.buffers[h] = &fakeBuffer{name: fn, lines: strings.Split(strings.TrimSuffix(string(src), "\n"), "\n")}
+		f.curBuf = h
+		f.cursor = [2]int{1, 1}
+		return nil
+	}
+	return nil
+}
+
+// eval understands the expressions neogo itself evaluates; anything else is
+// passed to the registered fakeEvals. Called with f.mu held
+func (f *fakeNvim) eval(expr string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(expr, "[winsaveview()['topline']"):
+		v := f.view
+		return []interface{}{int64(v.topline), int64(v.topline + v.height), int64(v.leftcol), int64(v.leftcol + v.width)}, nil
+
+	case expr == "[line('.'), col('.')]":
+		return []interface{}{int64(f.cursor[0]), int64(f.cursor[1])}, nil
+
+	case strings.HasPrefix(expr, "map(filter(getbufinfo("):
+		var res []interface{}
+		for h, b := range f.buffers {
+			if strings.HasSuffix(b.name, ".go") {
+				res = append(res, []interface{}{h, b.name})
+			}
+		}
+		return res, nil
+
+	case strings.HasPrefix(expr, "filter(copy(g:)"):
+		res := make(map[string]interface{})
+		for k, v := range f.vars {
+			if strings.HasPrefix(k, "neogo_") {
+				res[k] = v
+			}
+		}
+		return res, nil
+	}
+
+	if m := fakeMatchAddPos.FindStringSubmatch(expr); m != nil {
+		var p [3]int
+		for i := range p {
+			p[i], _ = strconv.Atoi(m[i+2])
+		}
+		f.lastMatch++
+		f.matches[f.lastMatch] = Span{Line: p[0], Col: p[1], Len: p[2], Class: m[1]}
+		return int64(f.lastMatch), nil
+	}
+
+	if m := fakeGetBufLine.FindStringSubmatch(expr); m != nil {
+		h, _ := strconv.ParseInt(m[1], 10, 64)
+		b, ok := f.buffers[h]
+		if !ok {
+			return []interface{}{}, nil
+		}
+		res := make([]interface{}, len(b.lines))
+		for i, l := range b.lines {
+			res[i] = l
+		}
+		return res, nil
+	}
+
+	if m := fakeMatchDelete.FindStringSubmatch(expr); m != nil {
+		id, _ := strconv.ParseUint(m[1], 10, 64)
+		if _, ok := f.matches[id]; !ok {
+			return nil, fmt.Errorf("E803: ID not found: %v", id)
+		}
+		delete(f.matches, id)
+		return int64(0), nil
+	}
+
+	for _, e := range f.evals {
+		if m := e.re.FindStringSubmatch(expr); m != nil {
+			return e.fn(m)
+		}
+	}
+
+	return nil, fmt.Errorf("fake nvim: cannot evaluate %v", expr)
+}
+
+// handleEval registers fn to answer vim_eval expressions matching re
+func (f *fakeNvim) handleEval(re string, fn func(m []string) (interface{}, error)) {
+	f.mu.Lock()
+	f.evals = append(f.evals, fakeEval{re: regexp.MustCompile(re), fn: fn})
+	f.mu.Unlock()
+}
+
+// setBuffer replaces the name and contents of the current buffer
+func (f *fakeNvim) setBuffer(name, src string) {
+	f.mu.Lock()
+	b := f.buffers[f.curBuf]
+	b.name = name
+	b.lines = strings.Split(src, "\n")
+	f.mu.Unlock()
+}
+
+// addBuffer loads a buffer called name holding src, without making it
+// current, and returns its handle
+func (f *fakeNvim) addBuffer(name, src string) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	h := int64(len(f.buffers) + 1)
+	f.buffers[h] = &fakeBuffer{name: name, lines: strings.Split(src, "\n")}
+	return h
+}
+
+// linesOf returns the lines of buffer h
+func (f *fakeNvim) linesOf(h int64) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.buffers[h].lines...)
+}
+
+// setCursor moves the cursor to the first occurrence of marker on line,
+// offset by delta bytes
+func (f *fakeNvim) setCursor(line int, marker string, delta int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	l := f.buffers[f.curBuf].lines[line-1]
+	f.cursor = [2]int{line, strings.Index(l, marker) + 1 + delta}
+}
+
+// current returns the name of the current buffer and the cursor position
+func (f *fakeNvim) current() (string, [2]int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.buffers[f.curBuf].name, f.cursor
+}
+
+func (f *fakeNvim) bufferLines() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.buffers[f.curBuf].lines...)
+}
+
+func (f *fakeNvim) setVar(name string, v interface{}) {
+	f.mu.Lock()
+	f.vars[name] = v
+	f.mu.Unlock()
+}
+
+func (f *fakeNvim) spans() []Span {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m := &recordingMatcher{matches: f.matches}
+	return m.spans()
+}
+
+// recorded returns the calls made so far for the given methods, or all calls
+// if none are given
+func (f *fakeNvim) recorded(methods ...string) []fakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []fakeCall
+	for _, c := range f.calls {
+		if len(methods) == 0 {
+			res = append(res, c)
+			continue
+		}
+		for _, m := range methods {
+			if c.Method == m {
+				res = append(res, c)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// waitFor polls cond until it returns true or timeout passes
+func waitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
@@ -0,0 +1,210 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/myitcv/neovim"
+)
+
+// maxFillDepth bounds how deep recursive fills go into struct fields
+const maxFillDepth = 5
+
+// FillStruct adds the fields missing from the struct literal under the
+// cursor, each with its zero value. With recursive, fields that are
+// themselves structs are filled in turn. Unexported fields of structs from
+// other packages are left out. Exposed as NeogoFillStruct and
+// :NeogoFillStruct[!]
+func (n *Neogo) FillStruct(o *neovim.MethodOptionParams, recursive bool) error {
+	return n.report(n.fillStruct(recursive))
+}
+
+func (n *Neogo) fillStruct(recursive bool) error {
+	if err := n.requireFeature(FeatureFillStruct); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	p, f, err := n.typeCheck(b)
+	if err != nil {
+		return err
+	}
+	lit := structLitAt(p, f, filePos(n.ldr.fset, f, b.offset(b.line, b.col)))
+	if lit == nil {
+		return fmt.Errorf("no struct literal under cursor")
+	}
+	e, err := fillStructEdit(n.ldr.fset, p, f, b.lines, lit, recursive)
+	if err != nil {
+		return err
+	}
+	return n.applyEdits([]lineEdit{e})
+}
+
+// structLitAt returns the innermost composite literal of a struct type
+// that contains pos, or nil
+func structLitAt(p *pkgInfo, f *ast.File, pos token.Pos) *ast.CompositeLit {
+	for _, nd := range enclosing(f, pos) {
+		lit, ok := nd.(*ast.CompositeLit)
+		if !ok {
+			continue
+		}
+		if tv, ok := p.info.Types[lit]; ok {
+			if _, ok := tv.Type.Underlying().(*types.Struct); ok {
+				return lit
+			}
+		}
+	}
+	return nil
+}
+
+// fillStructEdit returns the edit of lines, the source of f, that adds the
+// missing fields to lit. A literal on one line stays on one line, unless it
+// is empty; otherwise a field goes on each line before the closing brace
+func fillStructEdit(fset *token.FileSet, p *pkgInfo, f *ast.File, lines []string, lit *ast.CompositeLit, recursive bool) (lineEdit, error) {
+	st := p.info.Types[lit].Type.Underlying().(*types.Struct)
+	lb, rb := fset.Position(lit.Lbrace), fset.Position(lit.Rbrace)
+	// while being typed a literal may have no closing brace, the parser
+	// putting one at the end of the file
+	if rb.Line < 1 || rb.Line > len(lines) || rb.Column > len(lines[rb.Line-1]) || lines[rb.Line-1][rb.Column-1] != '}' {
+		return lineEdit{}, fmt.Errorf("the literal is incomplete")
+	}
+	present := make(map[string]bool)
+	for _, e := range lit.Elts {
+		kv, ok := e.(*ast.KeyValueExpr)
+		if !ok {
+			return lineEdit{}, fmt.Errorf("the literal has unkeyed fields")
+		}
+		if id, ok := kv.Key.(*ast.Ident); ok {
+			present[id.Name] = true
+		}
+	}
+	var missing []*types.Var
+	for _, fld := range visibleFields(st, p.pkg) {
+		if !present[fld.Name()] {
+			missing = append(missing, fld)
+		}
+	}
+	if missing == nil {
+		return lineEdit{}, fmt.Errorf("no fields to add")
+	}
+
+	z := zeroer{qual: fileQualifier(p, f), pkg: p.pkg, recursive: recursive}
+	line := lines[rb.Line-1]
+	head, tail := line[:rb.Column-1], line[rb.Column-1:]
+	indent := leadingSpace(lines[lb.Line-1])
+
+	if lb.Line == rb.Line && len(lit.Elts) > 0 {
+		var fs []string
+		for _, fld := range missing {
+			fs = append(fs, fld.Name()+": "+z.value(fld.Type(), "", 0))
+		}
+		head = strings.TrimSuffix(strings.TrimRight(head, " \t"), ",")
+		return lineEdit{start: rb.Line - 1, end: rb.Line, lines: []string{head + ", " + strings.Join(fs, ", ") + tail}}, nil
+	}
+
+	// the edit spans the whole literal so that gofmt can realign its fields
+	res := append([]string(nil), lines[lb.Line-1:rb.Line-1]...)
+	if strings.TrimSpace(head) != "" {
+		if !strings.HasSuffix(head, "{") && !strings.HasSuffix(head, ",") {
+			head += ","
+		}
+		res = append(res, head)
+	}
+	for _, fld := range missing {
+		v := z.value(fld.Type(), indent+"\t", 0)
+		res = append(res, strings.Split(indent+"\t"+fld.Name()+": "+v+",", "\n")...)
+	}
+	return aligned(lines, lineEdit{start: lb.Line - 1, end: rb.Line, lines: append(res, indent+tail)}), nil
+}
+
+// aligned returns e, an edit of lines, with its lines laid out as gofmt
+// would lay them out, so far as that changes only their contents
+func aligned(lines []string, e lineEdit) lineEdit {
+	fes, err := formatEdits(e.apply(lines))
+	if err != nil {
+		return e
+	}
+	res := append([]string(nil), e.lines...)
+	for _, fe := range fes {
+		if fe.start >= e.start && fe.end <= e.start+len(res) && fe.end-fe.start == len(fe.lines) {
+			copy(res[fe.start-e.start:], fe.lines)
+		}
+	}
+	e.lines = res
+	return e
+}
+
+// visibleFields returns the fields of st that code in pkg can set
+func visibleFields(st *types.Struct, pkg *types.Package) []*types.Var {
+	var res []*types.Var
+	for i := 0; i < st.NumFields(); i++ {
+		fld := st.Field(i)
+		if fld.Exported() || fld.Pkg() == pkg {
+			res = append(res, fld)
+		}
+	}
+	return res
+}
+
+func leadingSpace(s string) string {
+	return s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+}
+
+// zeroer writes zero values as Go source
+type zeroer struct {
+	qual      types.Qualifier
+	pkg       *types.Package
+	recursive bool
+}
+
+// value returns the zero value of t. Recursively filled struct literals
+// are written over several lines, indented from indent, unless indent is
+// empty
+func (z zeroer) value(t types.Type, indent string, depth int) string {
+	if _, ok := t.(*types.TypeParam); ok {
+		return "*new(" + types.TypeString(t, z.qual) + ")"
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return "false"
+		case u.Info()&types.IsString != 0:
+			return `""`
+		case u.Info()&types.IsNumeric != 0:
+			return "0"
+		}
+		return "nil"
+	case *types.Struct:
+		ts := types.TypeString(t, z.qual)
+		fields := visibleFields(u, z.pkg)
+		if !z.recursive || depth >= maxFillDepth || len(fields) == 0 {
+			return ts + "{}"
+		}
+		var fs []string
+		for _, fld := range fields {
+			next := ""
+			if indent != "" {
+				next = indent + "\t"
+			}
+			fs = append(fs, fld.Name()+": "+z.value(fld.Type(), next, depth+1))
+		}
+		if indent == "" {
+			return ts + "{" + strings.Join(fs, ", ") + "}"
+		}
+		return ts + "{\n" + indent + "\t" + strings.Join(fs, ",\n"+indent+"\t") + ",\n" + indent + "}"
+	case *types.Array:
+		return types.TypeString(t, z.qual) + "{}"
+	}
+	// pointers, slices, maps, channels, functions and interfaces
+	return "nil"
+}
@@ -0,0 +1,122 @@
+package neogo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+const fillStructTestSrc = `package a
+
+import (
+	"io"
+
+	other "example.com/p/b"
+)
+
+type point struct {
+	X, Y int
+	name string
+}
+
+type shape struct {
+	Origin point
+	Tags   []string
+	Done   bool
+	R      io.Reader
+	B      other.B
+	Grid   [2]float64
+}
+
+func f() {
+	_ = shape{}
+	_ = point{X: 1}
+	_ = other.B{
+		N: 1,
+	}
+	_ = point{1, 2, ""}
+}`
+
+func (t *PluginTest) TestFillStruct(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": fillStructTestSrc + "\n",
+		"b/b.go": "package b\n\ntype B struct {\n\tN      int\n\tS      string\n\tsecret bool\n}\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+	afn := filepath.Join(root, "a", "a.go")
+
+	fill := func(line int, marker string, recursive bool) ([]string, error) {
+		t.nvim.setBuffer(afn, fillStructTestSrc)
+		t.nvim.setCursor(line, marker, 0)
+		err := t.plug.FillStruct(nil, recursive)
+		return t.nvim.bufferLines(), err
+	}
+
+	// empty literal, recursively; the unexported field of b.B is left out
+	res, err := fill(24, "{", true)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Join(res[23:40], "\n"), Equals, `	_ = shape{
+		Origin: point{
+			X:    0,
+			Y:    0,
+			name: "",
+		},
+		Tags: nil,
+		Done: false,
+		R:    nil,
+		B: other.B{
+			N: 0,
+			S: "",
+		},
+		Grid: [2]float64{},
+	}
+	_ = point{X: 1}
+	_ = other.B{`)
+
+	// empty literal
+	res, err = fill(24, "shape", false)
+	c.Assert(err, IsNil)
+	c.Assert(res[24:31], DeepEquals, []string{
+		"\t\tOrigin: point{},",
+		"\t\tTags:   nil,",
+		"\t\tDone:   false,",
+		"\t\tR:      nil,",
+		"\t\tB:      other.B{},",
+		"\t\tGrid:   [2]float64{},",
+		"\t}",
+	})
+
+	// a literal on one line stays there
+	res, err = fill(25, "X", false)
+	c.Assert(err, IsNil)
+	c.Assert(res[24], Equals, `	_ = point{X: 1, Y: 0, name: ""}`)
+
+	// over several lines
+	res, err = fill(27, "N", false)
+	c.Assert(err, IsNil)
+	c.Assert(res[25:29], DeepEquals, []string{"\t_ = other.B{", "\t\tN: 1,", "\t\tS: \"\",", "\t}"})
+
+	_, err = fill(29, "1", false)
+	c.Assert(err, ErrorMatches, "the literal has unkeyed fields")
+
+	_, err = fill(27, "N", false)
+	c.Assert(err, IsNil)
+	_, err = fill(25, "X", false)
+	c.Assert(err, IsNil)
+	_, err = fill(21, "func", false)
+	c.Assert(err, ErrorMatches, "no struct literal under cursor")
+
+	// one with a trailing comma
+	t.nvim.setBuffer(afn, fillStructTestSrc+"\n\nvar x = point{X: 1,}")
+	t.nvim.setCursor(32, "X", 0)
+	c.Assert(t.plug.FillStruct(nil, false), IsNil)
+	c.Assert(t.nvim.bufferLines()[31], Equals, `var x = point{X: 1, Y: 0, name: ""}`)
+
+	// still being typed, without a closing brace
+	t.nvim.setBuffer(afn, fillStructTestSrc+"\n\nvar x = point{")
+	t.nvim.setCursor(32, "{", 0)
+	c.Assert(t.plug.FillStruct(nil, false), ErrorMatches, "the literal is incomplete")
+}
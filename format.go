@@ -0,0 +1,85 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"go/format"
+	"strings"
+
+	"github.com/myitcv/neovim"
+)
+
+// Fmt formats the current buffer with gofmt. Only the lines that change are
+// replaced, so the cursor, marks, folds and undo history of the rest of the
+// buffer are kept. Exposed as NeogoFmt and :NeogoFmt
+func (n *Neogo) Fmt(o *neovim.MethodOptionParams) error {
+	return n.report(n.fmt())
+}
+
+func (n *Neogo) fmt() error {
+	if err := n.requireFeature(FeatureFmt); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	edits, err := formatEdits(b.lines)
+	if err != nil {
+		return err
+	}
+	return n.applyEdits(edits)
+}
+
+// BufferPreWrite is called before buffer nr, which need not be current
+// (e.g. with :wall), is written. It organizes its imports if
+// g:neogo_imports_on_save is set, then formats it if g:neogo_fmt_on_save
+// is. It is synchronous so that what is written is the result. Exposed as
+// BufferPreWrite, called on BufWritePre
+func (n *Neogo) BufferPreWrite(o *neovim.MethodOptionParams, nr int) error {
+	return n.report(n.preWrite(nr))
+}
+
+func (n *Neogo) preWrite(nr int) error {
+	cfg := n.config()
+	imports := cfg.ImportsOnSave && cfg.Enabled(FeatureImports)
+	format := cfg.FmtOnSave && cfg.Enabled(FeatureFmt)
+	if !imports && !format {
+		return nil
+	}
+	b, err := n.buffer(nr)
+	if err != nil {
+		return err
+	}
+	if imports {
+		edits, err := n.importEdits(b)
+		if err != nil {
+			return err
+		}
+		if err := n.editBuffer(nr, edits); err != nil {
+			return err
+		}
+		if b, err = n.buffer(nr); err != nil {
+			return err
+		}
+	}
+	if format {
+		edits, err := formatEdits(b.lines)
+		if err != nil {
+			return err
+		}
+		return n.editBuffer(nr, edits)
+	}
+	return nil
+}
+
+// formatEdits returns the edits that gofmt lines, the contents of a buffer
+func formatEdits(lines []string) ([]lineEdit, error) {
+	res, err := format.Source([]byte(strings.Join(lines, "\n") + "\n"))
+	if err != nil {
+		return nil, err
+	}
+	return lineDiff(lines, strings.Split(strings.TrimSuffix(string(res), "\n"), "\n")), nil
+}
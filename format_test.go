@@ -0,0 +1,131 @@
+package neogo
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+const formatTestSrc = `package a
+
+import (
+	"strings"
+	"fmt"
+)
+
+type T struct {
+	A int
+	Long string
+}
+
+func f() {
+	// keep me
+	x:=1
+	fmt.Println(strings.ToUpper("x"),x)
+}
+`
+
+// Neovim holds no line after the final newline of a file, unlike
+// setBuffer, so the sources here lack one
+
+func (t *PluginTest) TestFmt(c *C) {
+	src := strings.TrimSuffix(formatTestSrc, "\n")
+	t.nvim.setBuffer("/tmp/a/a.go", src)
+	t.nvim.setCursor(14, "keep", 0)
+	c.Assert(t.plug.Fmt(nil), IsNil)
+
+	want := strings.Replace(src, "\t\"strings\"\n\t\"fmt\"\n", "\t\"fmt\"\n\t\"strings\"\n", 1)
+	want = strings.Replace(want, "\tA int\n\tLong string\n", "\tA    int\n\tLong string\n", 1)
+	want = strings.Replace(want, "x:=1", "x := 1", 1)
+	want = strings.Replace(want, `"x"),x)`, `"x"), x)`, 1)
+	c.Assert(strings.Join(t.nvim.bufferLines(), "\n"), Equals, want)
+
+	// only the lines that changed were replaced, the comment untouched
+	var edited []int
+	for _, call := range t.nvim.recorded("buffer_set_line_slice") {
+		s, _ := argInt(call.Args[1])
+		e, _ := argInt(call.Args[2])
+		for l := s; l < e; l++ {
+			edited = append(edited, l+1)
+		}
+	}
+	c.Assert(edited, DeepEquals, []int{15, 16, 9, 4})
+
+	// formatted already: no edits
+	n := len(t.nvim.recorded("buffer_set_line_slice"))
+	c.Assert(t.plug.Fmt(nil), IsNil)
+	c.Assert(t.nvim.recorded("buffer_set_line_slice"), HasLen, n)
+
+	t.nvim.setBuffer("/tmp/a/a.go", "package a\n\nfunc f( {")
+	c.Assert(t.plug.Fmt(nil), NotNil)
+}
+
+func (t *PluginTest) TestFmtOnSave(c *C) {
+	t.nvim.setBuffer("/tmp/a/a.go", "package a\nvar x=1")
+	cur := int(t.nvim.curBuf)
+	c.Assert(t.plug.BufferPreWrite(nil, cur), IsNil)
+	c.Assert(t.nvim.bufferLines(), DeepEquals, []string{"package a", "var x=1"})
+
+	t.nvim.setVar("neogo_fmt_on_save", int64(1))
+	c.Assert(t.plug.ReloadConfig(nil), IsNil)
+	c.Assert(t.plug.BufferPreWrite(nil, cur), IsNil)
+	c.Assert(t.nvim.bufferLines(), DeepEquals, []string{"package a", "", "var x = 1"})
+
+	// the buffer written, not the current one, e.g. with :wall
+	t.nvim.setBuffer("/tmp/a/a.go", "package a\nvar x=1")
+	h := t.nvim.addBuffer("/tmp/a/b.go", "package a\nvar y=2")
+	c.Assert(t.plug.BufferPreWrite(nil, int(h)), IsNil)
+	c.Assert(t.nvim.linesOf(h), DeepEquals, []string{"package a", "", "var y = 2"})
+	c.Assert(t.nvim.bufferLines(), DeepEquals, []string{"package a", "var x=1"})
+}
+
+func (t *PluginTest) TestLineDiff(c *C) {
+	apply := func(a []string, edits []lineEdit) []string {
+		res := append([]string{}, a...)
+		for i := len(edits) - 1; i >= 0; i-- {
+			e := edits[i]
+			res = append(res[:e.start], append(append([]string(nil), e.lines...), res[e.end:]...)...)
+		}
+		return res
+	}
+
+	a := []string{"a", "b", "c", "d", "e"}
+	b := []string{"a", "x", "c", "e", "f"}
+	edits := lineDiff(a, b)
+	c.Assert(edits, DeepEquals, []lineEdit{
+		{start: 1, end: 2, lines: []string{"x"}},
+		{start: 3, end: 4, lines: []string{}},
+		{start: 5, end: 5, lines: []string{"f"}},
+	})
+	c.Assert(lineDiff(a, a), IsNil)
+
+	r := rand.New(rand.NewSource(1))
+	random := func() []string {
+		res := make([]string, r.Intn(20))
+		for i := range res {
+			res[i] = string(rune('a' + r.Intn(4)))
+		}
+		return res
+	}
+	for i := 0; i < 500; i++ {
+		a, b := random(), append([]string{}, random()...)
+		c.Assert(apply(a, lineDiff(a, b)), DeepEquals, b, Commentf("%q -> %q", a, b))
+	}
+
+	// large buffers that differ everywhere are replaced in one edit, in
+	// memory bounded by maxDiff rather than their size
+	a, b = make([]string, 10000), make([]string, 10000)
+	for i := range a {
+		a[i], b[i] = fmt.Sprintf("a%v", i), fmt.Sprintf("b%v", i)
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	edits = lineDiff(a, b)
+	runtime.ReadMemStats(&after)
+	c.Assert(edits, HasLen, 1)
+	c.Assert(apply(a, edits), DeepEquals, b)
+	c.Assert(after.TotalAlloc-before.TotalAlloc < 32<<20, Equals, true, Commentf("%v bytes", after.TotalAlloc-before.TotalAlloc))
+}
@@ -31,3 +31,847 @@ func (g *bufferUpdateWrapper) Run() error {
 	err := g.Neogo.BufferUpdate(nil)
 	return err
 }
+
+// **************************
+// ReloadConfig
+func (n *Neogo) newReloadConfigResponder() neovim.AsyncDecoder {
+	return &reloadConfigWrapper{Neogo: n}
+}
+
+func (n *reloadConfigWrapper) Args() msgp.Decodable {
+	return new(neovim.NilDeocdable)
+}
+
+func (n *reloadConfigWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *reloadConfigWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type reloadConfigWrapper struct {
+	*Neogo
+}
+
+func (g *reloadConfigWrapper) Run() error {
+	err := g.Neogo.ReloadConfig(nil)
+	return err
+}
+
+// **************************
+// Definition
+func (n *Neogo) newDefinitionResponder() neovim.AsyncDecoder {
+	return &definitionWrapper{Neogo: n}
+}
+
+func (n *definitionWrapper) Args() msgp.Decodable {
+	return new(neovim.NilDeocdable)
+}
+
+func (n *definitionWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *definitionWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type definitionWrapper struct {
+	*Neogo
+}
+
+func (g *definitionWrapper) Run() error {
+	err := g.Neogo.Definition(nil)
+	return err
+}
+
+// **************************
+// References
+func (n *Neogo) newReferencesResponder() neovim.AsyncDecoder {
+	return &referencesWrapper{Neogo: n}
+}
+
+func (n *referencesWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *referencesWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *referencesWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type referencesWrapper struct {
+	*Neogo
+	args fnArgs
+}
+
+func (g *referencesWrapper) Run() error {
+	err := g.Neogo.References(nil, g.args.int(0) != 0)
+	return err
+}
+
+// **************************
+// Implements
+func (n *Neogo) newImplementsResponder() neovim.AsyncDecoder {
+	return &implementsWrapper{Neogo: n}
+}
+
+func (n *implementsWrapper) Args() msgp.Decodable {
+	return new(neovim.NilDeocdable)
+}
+
+func (n *implementsWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *implementsWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type implementsWrapper struct {
+	*Neogo
+}
+
+func (g *implementsWrapper) Run() error {
+	err := g.Neogo.Implements(nil)
+	return err
+}
+
+// **************************
+// Outline
+func (n *Neogo) newOutlineResponder() neovim.AsyncDecoder {
+	return &outlineWrapper{Neogo: n}
+}
+
+func (n *outlineWrapper) Args() msgp.Decodable {
+	return new(neovim.NilDeocdable)
+}
+
+func (n *outlineWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *outlineWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type outlineWrapper struct {
+	*Neogo
+}
+
+func (g *outlineWrapper) Run() error {
+	err := g.Neogo.Outline(nil)
+	return err
+}
+
+// **************************
+// Symbols
+func (n *Neogo) newSymbolsResponder() neovim.AsyncDecoder {
+	return &symbolsWrapper{Neogo: n}
+}
+
+func (n *symbolsWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *symbolsWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *symbolsWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type symbolsWrapper struct {
+	*Neogo
+	args fnArgs
+}
+
+func (g *symbolsWrapper) Run() error {
+	err := g.Neogo.Symbols(nil, g.args.str(0))
+	return err
+}
+
+// **************************
+// BufferWrite
+func (n *Neogo) newBufferWriteResponder() neovim.AsyncDecoder {
+	return &bufferWriteWrapper{Neogo: n}
+}
+
+func (n *bufferWriteWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *bufferWriteWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *bufferWriteWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type bufferWriteWrapper struct {
+	*Neogo
+	args fnArgs
+}
+
+func (g *bufferWriteWrapper) Run() error {
+	err := g.Neogo.BufferWrite(nil, g.args.str(0))
+	return err
+}
+
+// **************************
+// Callers
+func (n *Neogo) newCallersResponder() neovim.AsyncDecoder {
+	return &callersWrapper{Neogo: n}
+}
+
+func (n *callersWrapper) Args() msgp.Decodable {
+	return new(neovim.NilDeocdable)
+}
+
+func (n *callersWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *callersWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type callersWrapper struct {
+	*Neogo
+}
+
+func (g *callersWrapper) Run() error {
+	err := g.Neogo.Callers(nil)
+	return err
+}
+
+// **************************
+// Callees
+func (n *Neogo) newCalleesResponder() neovim.AsyncDecoder {
+	return &calleesWrapper{Neogo: n}
+}
+
+func (n *calleesWrapper) Args() msgp.Decodable {
+	return new(neovim.NilDeocdable)
+}
+
+func (n *calleesWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *calleesWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type calleesWrapper struct {
+	*Neogo
+}
+
+func (g *calleesWrapper) Run() error {
+	err := g.Neogo.Callees(nil)
+	return err
+}
+
+// **************************
+// CallTreeToggle
+func (n *Neogo) newCallTreeToggleResponder() neovim.AsyncDecoder {
+	return &callTreeToggleWrapper{Neogo: n}
+}
+
+func (n *callTreeToggleWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *callTreeToggleWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *callTreeToggleWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type callTreeToggleWrapper struct {
+	*Neogo
+	args fnArgs
+}
+
+func (g *callTreeToggleWrapper) Run() error {
+	err := g.Neogo.CallTreeToggle(nil, g.args.int(0))
+	return err
+}
+
+// **************************
+// CallTreeJump
+func (n *Neogo) newCallTreeJumpResponder() neovim.AsyncDecoder {
+	return &callTreeJumpWrapper{Neogo: n}
+}
+
+func (n *callTreeJumpWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *callTreeJumpWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *callTreeJumpWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type callTreeJumpWrapper struct {
+	*Neogo
+	args fnArgs
+}
+
+func (g *callTreeJumpWrapper) Run() error {
+	err := g.Neogo.CallTreeJump(nil, g.args.int(0))
+	return err
+}
+
+// **************************
+// Hover
+func (n *Neogo) newHoverResponder() neovim.AsyncDecoder {
+	return &hoverWrapper{Neogo: n}
+}
+
+func (n *hoverWrapper) Args() msgp.Decodable {
+	return new(neovim.NilDeocdable)
+}
+
+func (n *hoverWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *hoverWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type hoverWrapper struct {
+	*Neogo
+}
+
+func (g *hoverWrapper) Run() error {
+	err := g.Neogo.Hover(nil)
+	return err
+}
+
+// **************************
+// SignatureHelp
+func (n *Neogo) newSignatureHelpResponder() neovim.AsyncDecoder {
+	return &signatureHelpWrapper{Neogo: n}
+}
+
+func (n *signatureHelpWrapper) Args() msgp.Decodable {
+	return new(neovim.NilDeocdable)
+}
+
+func (n *signatureHelpWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *signatureHelpWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type signatureHelpWrapper struct {
+	*Neogo
+}
+
+func (g *signatureHelpWrapper) Run() error {
+	err := g.Neogo.SignatureHelp(nil)
+	return err
+}
+
+// **************************
+// Complete
+func (n *Neogo) newCompleteResponder() neovim.SyncDecoder {
+	return &completeWrapper{Neogo: n}
+}
+
+func (n *completeWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *completeWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *completeWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+func (n *completeWrapper) Results() msgp.Encodable {
+	return n.results
+}
+
+type completeWrapper struct {
+	*Neogo
+	args    fnArgs
+	results *completeResult
+}
+
+func (g *completeWrapper) Run() (error, error) {
+	res, err := g.Neogo.Complete(nil, g.args.int(0), g.args.str(1))
+	g.results = res
+	return err, nil
+}
+
+// **************************
+// CompleteDone
+func (n *Neogo) newCompleteDoneResponder() neovim.AsyncDecoder {
+	return &completeDoneWrapper{Neogo: n}
+}
+
+func (n *completeDoneWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *completeDoneWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *completeDoneWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type completeDoneWrapper struct {
+	*Neogo
+	args fnArgs
+}
+
+func (g *completeDoneWrapper) Run() error {
+	err := g.Neogo.CompleteDone(nil, g.args.str(0))
+	return err
+}
+
+// **************************
+// Fmt
+func (n *Neogo) newFmtResponder() neovim.AsyncDecoder {
+	return &fmtWrapper{Neogo: n}
+}
+
+func (n *fmtWrapper) Args() msgp.Decodable {
+	return new(neovim.NilDeocdable)
+}
+
+func (n *fmtWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *fmtWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type fmtWrapper struct {
+	*Neogo
+}
+
+func (g *fmtWrapper) Run() error {
+	err := g.Neogo.Fmt(nil)
+	return err
+}
+
+// **************************
+// BufferPreWrite
+func (n *Neogo) newBufferPreWriteResponder() neovim.SyncDecoder {
+	return &bufferPreWriteWrapper{Neogo: n}
+}
+
+func (n *bufferPreWriteWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *bufferPreWriteWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *bufferPreWriteWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+func (n *bufferPreWriteWrapper) Results() msgp.Encodable {
+	return noResult{}
+}
+
+type bufferPreWriteWrapper struct {
+	*Neogo
+	args fnArgs
+}
+
+func (g *bufferPreWriteWrapper) Run() (error, error) {
+	err := g.Neogo.BufferPreWrite(nil, g.args.int(0))
+	return err, nil
+}
+
+// noResult is the result of a synchronous function that returns nothing
+type noResult struct{}
+
+func (noResult) EncodeMsg(w *msgp.Writer) error {
+	return w.WriteNil()
+}
+
+// **************************
+// Imports
+func (n *Neogo) newImportsResponder() neovim.AsyncDecoder {
+	return &importsWrapper{Neogo: n}
+}
+
+func (n *importsWrapper) Args() msgp.Decodable {
+	return new(neovim.NilDeocdable)
+}
+
+func (n *importsWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *importsWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type importsWrapper struct {
+	*Neogo
+}
+
+func (g *importsWrapper) Run() error {
+	err := g.Neogo.Imports(nil)
+	return err
+}
+
+// **************************
+// Rename
+func (n *Neogo) newRenameResponder() neovim.AsyncDecoder {
+	return &renameWrapper{Neogo: n}
+}
+
+func (n *renameWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *renameWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *renameWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type renameWrapper struct {
+	*Neogo
+	args fnArgs
+}
+
+func (g *renameWrapper) Run() error {
+	err := g.Neogo.Rename(nil, g.args.str(0))
+	return err
+}
+
+// **************************
+// ExtractFunc
+func (n *Neogo) newExtractFuncResponder() neovim.AsyncDecoder {
+	return &extractFuncWrapper{Neogo: n}
+}
+
+func (n *extractFuncWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *extractFuncWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *extractFuncWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type extractFuncWrapper struct {
+	*Neogo
+	args fnArgs
+}
+
+func (g *extractFuncWrapper) Run() error {
+	err := g.Neogo.ExtractFunc(nil, g.args.str(0))
+	return err
+}
+
+// **************************
+// ExtractVar
+func (n *Neogo) newExtractVarResponder() neovim.AsyncDecoder {
+	return &extractVarWrapper{Neogo: n}
+}
+
+func (n *extractVarWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *extractVarWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *extractVarWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type extractVarWrapper struct {
+	*Neogo
+	args fnArgs
+}
+
+func (g *extractVarWrapper) Run() error {
+	err := g.Neogo.ExtractVar(nil, g.args.str(0))
+	return err
+}
+
+// **************************
+// FillStruct
+func (n *Neogo) newFillStructResponder() neovim.AsyncDecoder {
+	return &fillStructWrapper{Neogo: n}
+}
+
+func (n *fillStructWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *fillStructWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *fillStructWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type fillStructWrapper struct {
+	*Neogo
+	args fnArgs
+}
+
+func (g *fillStructWrapper) Run() error {
+	err := g.Neogo.FillStruct(nil, g.args.int(0) != 0)
+	return err
+}
+
+// **************************
+// Impl
+func (n *Neogo) newImplResponder() neovim.AsyncDecoder {
+	return &implWrapper{Neogo: n}
+}
+
+func (n *implWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *implWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *implWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type implWrapper struct {
+	*Neogo
+	args fnArgs
+}
+
+func (g *implWrapper) Run() error {
+	err := g.Neogo.Impl(nil, g.args.str(0))
+	return err
+}
+
+// **************************
+// AddTags
+func (n *Neogo) newAddTagsResponder() neovim.AsyncDecoder {
+	return &addTagsWrapper{Neogo: n}
+}
+
+func (n *addTagsWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *addTagsWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *addTagsWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type addTagsWrapper struct {
+	*Neogo
+	args fnArgs
+}
+
+func (g *addTagsWrapper) Run() error {
+	err := g.Neogo.AddTags(nil, g.args.int(0), g.args.int(1), g.args.str(2))
+	return err
+}
+
+// **************************
+// RemoveTags
+func (n *Neogo) newRemoveTagsResponder() neovim.AsyncDecoder {
+	return &removeTagsWrapper{Neogo: n}
+}
+
+func (n *removeTagsWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *removeTagsWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *removeTagsWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type removeTagsWrapper struct {
+	*Neogo
+	args fnArgs
+}
+
+func (g *removeTagsWrapper) Run() error {
+	err := g.Neogo.RemoveTags(nil, g.args.int(0), g.args.int(1), g.args.str(2))
+	return err
+}
+
+// **************************
+// IfErr
+func (n *Neogo) newIfErrResponder() neovim.AsyncDecoder {
+	return &ifErrWrapper{Neogo: n}
+}
+
+func (n *ifErrWrapper) Args() msgp.Decodable {
+	return new(neovim.NilDeocdable)
+}
+
+func (n *ifErrWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *ifErrWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type ifErrWrapper struct {
+	*Neogo
+}
+
+func (g *ifErrWrapper) Run() error {
+	err := g.Neogo.IfErr(nil)
+	return err
+}
+
+// **************************
+// CodeAction
+func (n *Neogo) newCodeActionResponder() neovim.AsyncDecoder {
+	return &codeActionWrapper{Neogo: n}
+}
+
+func (n *codeActionWrapper) Args() msgp.Decodable {
+	return new(neovim.NilDeocdable)
+}
+
+func (n *codeActionWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *codeActionWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type codeActionWrapper struct {
+	*Neogo
+}
+
+func (g *codeActionWrapper) Run() error {
+	err := g.Neogo.CodeAction(nil)
+	return err
+}
+
+// **************************
+// Alternate
+func (n *Neogo) newAlternateResponder() neovim.AsyncDecoder {
+	return &alternateWrapper{Neogo: n}
+}
+
+func (n *alternateWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *alternateWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *alternateWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type alternateWrapper struct {
+	*Neogo
+	args fnArgs
+}
+
+func (g *alternateWrapper) Run() error {
+	err := g.Neogo.Alternate(nil, g.args.int(0) != 0)
+	return err
+}
+
+// **************************
+// GenTest
+func (n *Neogo) newGenTestResponder() neovim.AsyncDecoder {
+	return &genTestWrapper{Neogo: n}
+}
+
+func (n *genTestWrapper) Args() msgp.Decodable {
+	return new(neovim.NilDeocdable)
+}
+
+func (n *genTestWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *genTestWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type genTestWrapper struct {
+	*Neogo
+}
+
+func (g *genTestWrapper) Run() error {
+	err := g.Neogo.GenTest(nil)
+	return err
+}
+
+// **************************
+// BufferEnter
+func (n *Neogo) newBufferEnterResponder() neovim.AsyncDecoder {
+	return &bufferEnterWrapper{Neogo: n}
+}
+
+func (n *bufferEnterWrapper) Args() msgp.Decodable {
+	return &n.args
+}
+
+func (n *bufferEnterWrapper) Params() *neovim.MethodOptionParams {
+	return nil
+}
+
+func (n *bufferEnterWrapper) Eval() msgp.Decodable {
+	return nil
+}
+
+type bufferEnterWrapper struct {
+	*Neogo
+	args fnArgs
+}
+
+func (g *bufferEnterWrapper) Run() error {
+	err := g.Neogo.BufferEnter(nil, g.args.str(0))
+	return err
+}
@@ -0,0 +1,315 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/myitcv/neovim"
+)
+
+// Alternate opens the alternate of the current file: foo_test.go for foo.go
+// and foo.go for foo_test.go. Unless force, the alternate must exist.
+// Exposed as NeogoAlternate and :NeogoAlternate[!]
+func (n *Neogo) Alternate(o *neovim.MethodOptionParams, force bool) error {
+	return n.report(n.alternate(force))
+}
+
+func (n *Neogo) alternate(force bool) error {
+	if err := n.requireFeature(FeatureTest); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	alt, ok := alternateFile(b.name)
+	if !ok {
+		return fmt.Errorf("%v is not a Go file", filepath.Base(b.name))
+	}
+	if _, err := os.Stat(alt); err != nil && !force {
+		return fmt.Errorf("%v does not exist", filepath.Base(alt))
+	}
+	return n.edit(alt)
+}
+
+// alternateFile returns the test file of fn, or the file it tests
+func alternateFile(fn string) (string, bool) {
+	switch {
+	case strings.HasSuffix(fn, "_test.go"):
+		return strings.TrimSuffix(fn, "_test.go") + ".go", true
+	case strings.HasSuffix(fn, ".go"):
+		return strings.TrimSuffix(fn, ".go") + "_test.go", true
+	}
+	return "", false
+}
+
+// GenTest appends a table-driven test of the function or method under the
+// cursor to the test file of the current file, creating it if need be, and
+// jumps to it. The table has a field for the receiver, each parameter and
+// each result, with wantErr for a final error; the test compares results
+// with != where they are of basic types, otherwise with reflect.DeepEqual.
+// The test file is edited in its buffer if it is open, otherwise on disk.
+// Exposed as NeogoGenTest and :NeogoGenTest
+func (n *Neogo) GenTest(o *neovim.MethodOptionParams) error {
+	return n.report(n.genTest())
+}
+
+func (n *Neogo) genTest() error {
+	if err := n.requireFeature(FeatureTest); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	tfn, ok := alternateFile(b.name)
+	if !ok || strings.HasSuffix(b.name, "_test.go") {
+		return fmt.Errorf("%v is not a Go file under test", filepath.Base(b.name))
+	}
+	p, f, err := n.typeCheck(b)
+	if err != nil {
+		return err
+	}
+	var fd *ast.FuncDecl
+	for _, nd := range enclosing(f, filePos(n.ldr.fset, f, b.offset(b.line, b.col))) {
+		if d, ok := nd.(*ast.FuncDecl); ok {
+			fd = d
+			break
+		}
+	}
+	if fd == nil {
+		return fmt.Errorf("no function under cursor")
+	}
+	fn, ok := p.info.Defs[fd.Name].(*types.Func)
+	if !ok {
+		return fmt.Errorf("could not resolve %v", fd.Name.Name)
+	}
+	sig := fn.Type().(*types.Signature)
+	if sig.TypeParams().Len() > 0 || sig.RecvTypeParams().Len() > 0 {
+		return fmt.Errorf("cannot generate a test of generic %v", fn.Name())
+	}
+	if sig.Recv() == nil && (fn.Name() == "init" || fn.Name() == "main" && p.pkg.Name() == "main") {
+		return fmt.Errorf("cannot generate a test of %v", fn.Name())
+	}
+
+	// the test file as it is, in its buffer or on disk, or as it will start
+	bufs, err := n.openBuffers()
+	if err != nil {
+		return err
+	}
+	nr, open := bufs[tfn]
+	var old []string
+	if open {
+		if old, err = n.bufLines(nr); err != nil {
+			return err
+		}
+	} else if src, err := ioutil.ReadFile(tfn); err == nil {
+		old = srcLines(src)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	lines := old
+	if lines == nil {
+		lines = []string{"package " + p.pkg.Name()}
+	}
+	tf, err := parser.ParseFile(token.NewFileSet(), tfn, strings.Join(lines, "\n"), 0)
+	if err != nil {
+		return err
+	}
+
+	external := tf.Name.Name != p.pkg.Name()
+	if external && !fn.Exported() {
+		return fmt.Errorf("%v is not exported, so cannot be tested from package %v", fn.Name(), tf.Name.Name)
+	}
+	need := make(map[string]bool)
+	ref := func(path, name string) string {
+		for _, s := range tf.Imports {
+			if importPath(s) == path {
+				if s.Name != nil {
+					return s.Name.Name
+				}
+				return name
+			}
+		}
+		need[path] = true
+		return name
+	}
+	qual := func(other *types.Package) string {
+		if other == p.pkg && !external {
+			return ""
+		}
+		return ref(other.Path(), other.Name())
+	}
+
+	name := testName(fn)
+	if tf.Scope.Lookup(name) != nil {
+		return fmt.Errorf("%v already exists in %v", name, filepath.Base(tfn))
+	}
+	at := len(lines) + 1
+	lines = append(append(lines, ""), testFunc(name, fn, qual, ref)...)
+	lines = aligned(lines, lineEdit{start: at, end: len(lines), lines: lines[at:]}).apply(lines)
+
+	var paths []string
+	for path := range need {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fset := token.NewFileSet()
+		nf, err := parser.ParseFile(fset, tfn, strings.Join(lines, "\n"), parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+		if e, ok := importEdit(fset, nf, lines, path); ok {
+			lines = e.apply(lines)
+			at += len(e.lines) - (e.end - e.start)
+		}
+	}
+
+	if open {
+		err = n.editBuffer(nr, lineDiff(old, lines))
+	} else {
+		if err = writeFiles(map[string][]byte{tfn: []byte(strings.Join(lines, "\n") + "\n")}); err == nil {
+			n.ldr.clearOverlay(tfn)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return n.jumpTo(b.name, token.Position{Filename: tfn, Line: at + 1, Column: 1})
+}
+
+// testName returns the name of the test of fn: TestF for an exported
+// function F, Test_f for an unexported f and TestT_M for a method M of T
+func testName(fn *types.Func) string {
+	if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+		t := recv.Type()
+		if pt, ok := t.(*types.Pointer); ok {
+			t = pt.Elem()
+		}
+		if nt, ok := t.(*types.Named); ok {
+			return "Test" + nt.Obj().Name() + "_" + fn.Name()
+		}
+	}
+	if fn.Exported() {
+		return "Test" + fn.Name()
+	}
+	return "Test_" + fn.Name()
+}
+
+// testFunc returns the lines of the test called name of fn. qual qualifies
+// types and ref names packages, by path and name, in the test file
+func testFunc(name string, fn *types.Func, qual types.Qualifier, ref func(path, name string) string) []string {
+	sig := fn.Type().(*types.Signature)
+	taken := map[string]bool{"t": true, "tt": true, "tests": true, "name": true, "err": true, "wantErr": true}
+	field := func(s string, i int) string {
+		if s == "" || s == "_" || taken[s] || token.Lookup(s).IsKeyword() {
+			s = fmt.Sprintf("arg%v", i+1)
+		}
+		for taken[s] {
+			s += "_"
+		}
+		taken[s] = true
+		return s
+	}
+
+	// the results are named first, so that the parameters give way to them
+	rs := sig.Results()
+	hasErr := rs.Len() > 0 && types.Identical(rs.At(rs.Len()-1).Type(), types.Universe.Lookup("error").Type())
+	var gots, wants []string
+	for i := 0; i < rs.Len(); i++ {
+		if hasErr && i == rs.Len()-1 {
+			break
+		}
+		got, want := "got", "want"
+		if k := len(wants); k > 0 {
+			got, want = fmt.Sprintf("got%v", k), fmt.Sprintf("want%v", k)
+		}
+		gots, wants = append(gots, field(got, i)), append(wants, field(want, i))
+	}
+
+	fields := []string{"name string"}
+	callee := fn.Name()
+	if pkg := qual(fn.Pkg()); pkg != "" {
+		callee = pkg + "." + callee
+	}
+	display := fn.Name()
+	if recv := sig.Recv(); recv != nil {
+		r := recv.Name()
+		if r == "" || r == "_" || taken[r] {
+			r = "recv"
+		}
+		taken[r] = true
+		fields = append(fields, r+" "+types.TypeString(recv.Type(), qual))
+		callee = "tt." + r + "." + fn.Name()
+		display = strings.TrimPrefix(testName(fn), "Test")
+		display = strings.Replace(display, "_", ".", 1)
+	}
+	var args []string
+	for i := 0; i < sig.Params().Len(); i++ {
+		v := sig.Params().At(i)
+		f := field(v.Name(), i)
+		fields = append(fields, f+" "+types.TypeString(v.Type(), qual))
+		if sig.Variadic() && i == sig.Params().Len()-1 {
+			f += "..."
+		}
+		args = append(args, "tt."+f)
+	}
+
+	var checks []string
+	for i, want := range wants {
+		got := gots[i]
+		fields = append(fields, want+" "+types.TypeString(rs.At(i).Type(), qual))
+		cond := got + " != tt." + want
+		if _, ok := rs.At(i).Type().Underlying().(*types.Basic); !ok {
+			cond = "!" + ref("reflect", "reflect") + ".DeepEqual(" + got + ", tt." + want + ")"
+		}
+		checks = append(checks,
+			"\t\t\tif "+cond+" {",
+			fmt.Sprintf("\t\t\t\tt.Errorf(\"%v() %v = %%v, want %%v\", %v, tt.%v)", display, got, got, want),
+			"\t\t\t}",
+		)
+	}
+	if hasErr {
+		gots = append(gots, "err")
+		fields = append(fields, "wantErr bool")
+	}
+
+	call := callee + "(" + strings.Join(args, ", ") + ")"
+	if gots != nil {
+		call = strings.Join(gots, ", ") + " := " + call
+	}
+	res := []string{"func " + name + "(t *" + ref("testing", "testing") + ".T) {", "\ttests := []struct {"}
+	for _, f := range fields {
+		res = append(res, "\t\t"+f)
+	}
+	res = append(res,
+		"\t}{",
+		"\t\t// TODO: add test cases.",
+		"\t}",
+		"\tfor _, tt := range tests {",
+		"\t\tt.Run(tt.name, func(t *"+ref("testing", "testing")+".T) {",
+		"\t\t\t"+call,
+	)
+	if hasErr {
+		res = append(res,
+			"\t\t\tif (err != nil) != tt.wantErr {",
+			fmt.Sprintf("\t\t\t\tt.Fatalf(\"%v() error = %%v, wantErr %%v\", err, tt.wantErr)", display),
+			"\t\t\t}",
+		)
+	}
+	res = append(res, checks...)
+	return append(res, "\t\t})", "\t}", "}")
+}
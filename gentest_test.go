@@ -0,0 +1,139 @@
+package neogo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+const genTestSrc = `package a
+
+import "io"
+
+type T struct{ n int }
+
+func Parse(s string, opts ...int) (T, error) {
+	return T{}, nil
+}
+
+func (t *T) add(r io.Reader, _ int) (int, bool) {
+	return t.n, false
+}
+
+func Check(want int, wantErr bool, got string) (int, error) {
+	return want, nil
+}`
+
+func (t *PluginTest) TestGenTest(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": genTestSrc + "\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+	afn := filepath.Join(root, "a", "a.go")
+	tfn := filepath.Join(root, "a", "a_test.go")
+
+	t.nvim.setBuffer(afn, genTestSrc)
+	c.Assert(t.plug.Alternate(nil, false), ErrorMatches, "a_test.go does not exist")
+
+	// the test file is created on disk
+	t.nvim.setCursor(8, "return", 0)
+	c.Assert(t.plug.GenTest(nil), IsNil)
+	src, err := ioutil.ReadFile(tfn)
+	c.Assert(err, IsNil)
+	c.Assert(string(src), Equals, `package a
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		opts    []int
+		want    T
+		wantErr bool
+	}{
+		// TODO: add test cases.
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.s, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+`)
+	name, cursor := t.nvim.current()
+	c.Assert(name, Equals, tfn)
+	c.Assert(cursor, Equals, [2]int{8, 1})
+
+	// back to a.go; the test file is now edited in its buffer
+	c.Assert(t.plug.Alternate(nil, false), IsNil)
+	name, _ = t.nvim.current()
+	c.Assert(name, Equals, afn)
+	t.nvim.setCursor(11, "add", 0)
+	c.Assert(t.plug.GenTest(nil), IsNil)
+	name, cursor = t.nvim.current()
+	c.Assert(name, Equals, tfn)
+	c.Assert(cursor, Equals, [2]int{32, 1})
+	res := t.nvim.bufferLines()
+	c.Assert(res[2:7], DeepEquals, []string{"import (", "\t\"io\"", "\t\"reflect\"", "\t\"testing\"", ")"})
+	c.Assert(strings.Join(res[31:], "\n"), Equals, `func TestT_add(t *testing.T) {
+	tests := []struct {
+		name  string
+		recv  *T
+		r     io.Reader
+		arg2  int
+		want  int
+		want1 bool
+	}{
+		// TODO: add test cases.
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, got1 := tt.recv.add(tt.r, tt.arg2)
+			if got != tt.want {
+				t.Errorf("T.add() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("T.add() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}`)
+
+	c.Assert(t.plug.Alternate(nil, false), IsNil)
+	t.nvim.setCursor(11, "add", 0)
+	c.Assert(t.plug.GenTest(nil), ErrorMatches, "TestT_add already exists in a_test.go")
+	t.nvim.setCursor(5, "T", 0)
+	c.Assert(t.plug.GenTest(nil), ErrorMatches, "no function under cursor")
+
+	// parameters named as the fields of the results give way to them
+	t.nvim.setCursor(16, "return", 0)
+	c.Assert(t.plug.GenTest(nil), IsNil)
+	res = t.nvim.bufferLines()
+	c.Assert(strings.Join(res[55:67], "\n"), Equals, `func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		arg1    int
+		arg2    bool
+		arg3    string
+		want    int
+		wantErr bool
+	}{
+		// TODO: add test cases.
+	}
+	for _, tt := range tests {`)
+	c.Assert(res[68], Equals, "\t\t\tgot, err := Check(tt.arg1, tt.arg2, tt.arg3)")
+}
@@ -0,0 +1,73 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"go/parser"
+	"go/token"
+	"math"
+	"sort"
+)
+
+// Span is a single highlighted region of a file. Line and Col are 1-based, Col
+// and Len are in bytes, exactly as passed to matchaddpos. Class is the
+// highlight group.
+type Span struct {
+	Line  int    `json:"line"`
+	Col   int    `json:"col"`
+	Len   int    `json:"length"`
+	Class string `json:"class"`
+}
+
+// Highlight runs the parse-and-classify pipeline neogo uses for a buffer over
+// src, without any viewport restriction, and returns the resulting spans in
+// file order. As in the plugin, parse errors do not prevent highlighting: the
+// spans for whatever could be parsed are returned alongside the error.
+func Highlight(filename string, src []byte) ([]Span, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.AllErrors|parser.ParseComments)
+	if f == nil {
+		return nil, err
+	}
+
+	sg := NewSynGenerator()
+	sg.lEnd = math.MaxUint64
+	sg.cEnd = math.MaxUint64
+	sg.generate(fset, f)
+
+	return sg.spans(), err
+}
+
+// spans returns the positions currently recorded by s in file order
+func (s *synGenerator) spans() []Span {
+	res := make([]Span, 0, len(s.nodes))
+	for pos := range s.nodes {
+		res = append(res, Span{
+			Line:  pos.line,
+			Col:   pos.col,
+			Len:   pos.l,
+			Class: pos.t.String(),
+		})
+	}
+	sort.Sort(spansByPos(res))
+	return res
+}
+
+type spansByPos []Span
+
+func (s spansByPos) Len() int      { return len(s) }
+func (s spansByPos) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s spansByPos) Less(i, j int) bool {
+	if s[i].Line != s[j].Line {
+		return s[i].Line < s[j].Line
+	}
+	if s[i].Col != s[j].Col {
+		return s[i].Col < s[j].Col
+	}
+	if s[i].Len != s[j].Len {
+		return s[i].Len < s[j].Len
+	}
+	return s[i].Class < s[j].Class
+}
@@ -0,0 +1,138 @@
+package neogo
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+var fUpdate = flag.Bool("update", false, "regenerate the golden files under _testfiles/golden")
+
+type HighlightTest struct{}
+
+var _ = Suite(&HighlightTest{})
+
+// recordingMatcher is an in-memory matcher that keeps the set of live matches
+type recordingMatcher struct {
+	lastID  uint64
+	adds    int
+	deletes int
+	matches map[uint64]Span
+}
+
+func newRecordingMatcher() *recordingMatcher {
+	return &recordingMatcher{matches: make(map[uint64]Span)}
+}
+
+func (r *recordingMatcher) addMatch(class string, line, col, l int) (uint64, error) {
+	r.lastID++
+	r.adds++
+	r.matches[r.lastID] = Span{Line: line, Col: col, Len: l, Class: class}
+	return r.lastID, nil
+}
+
+func (r *recordingMatcher) deleteMatch(id uint64) error {
+	r.deletes++
+	delete(r.matches, id)
+	return nil
+}
+
+func (r *recordingMatcher) spans() []Span {
+	var res []Span
+	for _, s := range r.matches {
+		res = append(res, s)
+	}
+	sort.Sort(spansByPos(res))
+	return res
+}
+
+// sweep runs src through the same steps as Neogo.highlight, with an unlimited
+// viewport, against m
+func sweep(sg *synGenerator, m matcher, fn string, src []byte) {
+	sg.lEnd = math.MaxUint64
+	sg.cEnd = math.MaxUint64
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, fn, src, parser.AllErrors|parser.ParseComments)
+	sg.generate(fset, f)
+	sg.sweepMap(m)
+}
+
+func encodeSpans(spans []Span) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, s := range spans {
+		enc.Encode(s)
+	}
+	return buf.Bytes()
+}
+
+func (t *HighlightTest) TestGolden(c *C) {
+	files, err := filepath.Glob("_testfiles/golden/*.go")
+	c.Assert(err, IsNil)
+	c.Assert(len(files) > 0, Equals, true)
+
+	for _, fn := range files {
+		src, err := ioutil.ReadFile(fn)
+		c.Assert(err, IsNil)
+
+		m := newRecordingMatcher()
+		sweep(NewSynGenerator(), m, fn, src)
+		got := encodeSpans(m.spans())
+		for _, sp := range m.spans() {
+			c.Assert(sp.Line > 0 && sp.Col > 0, Equals, true, Commentf("%v: %+v", fn, sp))
+		}
+
+		// the plugin and neogo highlight must agree
+		spans, _ := Highlight(fn, src)
+		c.Check(string(encodeSpans(spans)), Equals, string(got), Commentf("%v", fn))
+
+		golden := strings.TrimSuffix(fn, ".go") + ".golden"
+		if *fUpdate {
+			err := ioutil.WriteFile(golden, got, 0644)
+			c.Assert(err, IsNil)
+			continue
+		}
+		want, err := ioutil.ReadFile(golden)
+		c.Assert(err, IsNil, Commentf("run go test -update to create %v", golden))
+		c.Check(string(got), Equals, string(want), Commentf("%v", fn))
+	}
+}
+
+func (t *HighlightTest) TestIncremental(c *C) {
+	sg := NewSynGenerator()
+	m := newRecordingMatcher()
+
+	src := "package p\n\nfunc f() string {\n\treturn \"a\"\n}\n"
+	sweep(sg, m, "p.go", []byte(src))
+	c.Assert(m.deletes, Equals, 0)
+	adds := m.adds
+	want := m.spans()
+
+	// nothing changed, so nothing should be added or deleted
+	sweep(sg, m, "p.go", []byte(src))
+	c.Assert(m.adds, Equals, adds)
+	c.Assert(m.deletes, Equals, 0)
+	c.Assert(m.spans(), DeepEquals, want)
+
+	// the string moves; only its match changes
+	src = "package p\n\nfunc f() string {\n\treturn  \"a\"\n}\n"
+	sweep(sg, m, "p.go", []byte(src))
+	c.Assert(m.adds, Equals, adds+1)
+	c.Assert(m.deletes, Equals, 1)
+	c.Assert(m.spans(), DeepEquals, highlightString(c, "p.go", src))
+}
+
+func highlightString(c *C, fn, src string) []Span {
+	spans, err := Highlight(fn, []byte(src))
+	c.Assert(err, IsNil)
+	return spans
+}
@@ -0,0 +1,251 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/myitcv/neovim"
+)
+
+// Hover shows, in a floating window, the type or signature of the object
+// under the cursor, its package and its doc comment. When the buffer cannot
+// be type-checked what can be found by parsing it alone is shown instead.
+// Exposed as NeogoHover and :NeogoHover
+func (n *Neogo) Hover(o *neovim.MethodOptionParams) error {
+	return n.report(n.hover())
+}
+
+func (n *Neogo) hover() error {
+	if err := n.requireFeature(FeatureHover); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	p, f, err := n.typeCheck(b)
+	if err == nil {
+		lines, err = n.typedHover(p, f, filePos(n.ldr.fset, f, b.offset(b.line, b.col)))
+	}
+	if lines == nil {
+		if err != nil {
+			n.debugf("hover: falling back to syntax: %v", err)
+		}
+		lines, err = syntacticHover(b)
+	}
+	if err != nil {
+		return err
+	}
+	return n.float(lines, floatOptions{
+		filetype: "markdown",
+		closeOn:  "CursorMoved,InsertEnter,BufLeave",
+	})
+}
+
+// typedHover describes the object at pos. It returns nil lines, and
+// possibly an error, if there is none
+func (n *Neogo) typedHover(p *pkgInfo, f *ast.File, pos token.Pos) ([]string, error) {
+	id, obj := objectAt(p, f, pos)
+	if id == nil {
+		return nil, fmt.Errorf("no identifier under cursor")
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("could not resolve %v", id.Name)
+	}
+
+	qual := types.RelativeTo(p.pkg)
+	if pn, ok := obj.(*types.PkgName); ok {
+		ip := pn.Imported()
+		return hoverLines("package "+ip.Name(), "import "+fmt.Sprintf("%q", ip.Path()), n.packageDoc(ip)), nil
+	}
+
+	where := "builtin"
+	if obj.Pkg() != nil {
+		where = "package " + obj.Pkg().Path()
+	}
+	return hoverLines(types.ObjectString(obj, qual), where, n.objectDoc(obj)), nil
+}
+
+// objectDoc returns the doc comment of obj, found in the syntax of the
+// loaded packages
+func (n *Neogo) objectDoc(obj types.Object) *ast.CommentGroup {
+	obj = origin(obj)
+	if !obj.Pos().IsValid() {
+		return nil
+	}
+	f := n.fileOf(obj.Pos())
+	if f == nil {
+		return nil
+	}
+	return declDoc(f, obj.Pos())
+}
+
+// packageDoc returns the package comment of pkg, if it has been loaded
+func (n *Neogo) packageDoc(pkg *types.Package) *ast.CommentGroup {
+	for _, p := range n.ldr.cached() {
+		if p.pkg != pkg {
+			continue
+		}
+		for _, f := range p.files {
+			if f.Doc != nil {
+				return f.Doc
+			}
+		}
+	}
+	return nil
+}
+
+// fileOf returns the loaded file that contains pos, or nil
+func (n *Neogo) fileOf(pos token.Pos) *ast.File {
+	tf := n.ldr.fset.File(pos)
+	if tf == nil {
+		return nil
+	}
+	for _, p := range n.ldr.cached() {
+		for _, f := range p.files {
+			if n.ldr.fset.File(f.Pos()) == tf {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// declDoc returns the doc comment of the declaration in f of the identifier
+// at pos, following go/doc: the comment of a spec, else of its declaration
+// if that has a single spec, or a field's trailing comment failing its doc
+func declDoc(f *ast.File, pos token.Pos) *ast.CommentGroup {
+	var spec *ast.CommentGroup
+	for _, nd := range enclosing(f, pos) {
+		switch nd := nd.(type) {
+		case *ast.Field:
+			if nd.Doc != nil {
+				return nd.Doc
+			}
+			return nd.Comment
+		case *ast.ValueSpec:
+			if nd.Doc != nil {
+				return nd.Doc
+			}
+			spec = nd.Comment
+		case *ast.TypeSpec:
+			if nd.Doc != nil {
+				return nd.Doc
+			}
+			spec = nd.Comment
+		case *ast.GenDecl:
+			if !nd.Lparen.IsValid() && nd.Doc != nil {
+				return nd.Doc
+			}
+			return spec
+		case *ast.FuncDecl:
+			if nd.Name.Pos() == pos {
+				return nd.Doc
+			}
+			return nil
+		case ast.Stmt:
+			// a local declaration
+			return nil
+		}
+	}
+	return nil
+}
+
+// hoverLines formats the hover text as markdown: the declaration as Go
+// code, where it is from and the doc comment. The comment is rendered as
+// text by go/doc, as markdown would need escapes that show in the window
+func hoverLines(decl, where string, cg *ast.CommentGroup) []string {
+	res := []string{"```go", decl, "```", where}
+	if cg == nil {
+		return res
+	}
+	var p doc.Package
+	text := strings.TrimSpace(string(p.Printer().Text(p.Parser().Parse(cg.Text()))))
+	if text != "" {
+		res = append(res, "")
+		res = append(res, strings.Split(text, "\n")...)
+	}
+	return res
+}
+
+// syntacticHover describes the identifier under the cursor from the syntax
+// of the buffer alone: its declaration, if in the same file, and its doc
+// comment
+func syntacticHover(b *bufferState) ([]string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, b.name, b.src(), parser.AllErrors|parser.ParseComments)
+	if f == nil {
+		return nil, err
+	}
+	id := identAt(f, filePos(fset, f, b.offset(b.line, b.col)))
+	if id == nil {
+		return nil, fmt.Errorf("no identifier under cursor")
+	}
+
+	var decl ast.Node
+	if id.Obj != nil {
+		decl, _ = id.Obj.Decl.(ast.Node)
+	}
+	if decl == nil {
+		// perhaps a method or field, which the parser does not resolve;
+		// take the first declaration in the file with the same name
+		ast.Inspect(f, func(nd ast.Node) bool {
+			if decl != nil {
+				return false
+			}
+			switch nd := nd.(type) {
+			case *ast.FuncDecl:
+				if nd.Name.Name == id.Name {
+					decl = nd
+				}
+			case *ast.Field:
+				for _, fid := range nd.Names {
+					if fid.Name == id.Name {
+						decl = nd
+					}
+				}
+			}
+			return true
+		})
+	}
+	if decl == nil {
+		return nil, fmt.Errorf("no declaration of %v found in %v", id.Name, f.Name.Name)
+	}
+
+	var text string
+	var namePos token.Pos
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		text, namePos = funcSignature(fset, d), d.Name.Pos()
+	case *ast.TypeSpec:
+		s := *d
+		s.Doc, s.Comment = nil, nil
+		text, namePos = "type "+nodeString(fset, &s), d.Name.Pos()
+	case *ast.ValueSpec:
+		s := *d
+		s.Doc, s.Comment = nil, nil
+		kind := "var"
+		if id.Obj != nil && id.Obj.Kind == ast.Con {
+			kind = "const"
+		}
+		text, namePos = kind+" "+nodeString(fset, &s), d.Pos()
+	case *ast.Field:
+		text, namePos = id.Name+" "+nodeString(fset, d.Type), d.Pos()
+	case *ast.AssignStmt:
+		text, namePos = nodeString(fset, d), d.Pos()
+	default:
+		text, namePos = id.Name, id.Pos()
+	}
+	return hoverLines(text, "package "+f.Name.Name+" (syntax only)", declDoc(f, namePos)), nil
+}
@@ -0,0 +1,70 @@
+package neogo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+const hoverTestSrc = `package a
+
+import "example.com/p/b"
+
+// T is a thing.
+//
+// It has [b.B].
+type T struct {
+	// X is the x.
+	X int
+}
+
+// F returns x.
+func F(x int) int { return x + b.B }
+
+var v = T{X: F(1)}`
+
+func (t *PluginTest) TestHover(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go":       hoverTestSrc,
+		"a/ignored.go": "//go:build ignore\n\npackage a\n\n// G is ignored.\nfunc G() {}\n\nvar y = G\n",
+		"b/b.go":       "// Package b has B.\npackage b\n\n// B is one.\nconst B = 1\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+
+	afn := filepath.Join(root, "a", "a.go")
+	ifn := filepath.Join(root, "a", "ignored.go")
+
+	lastFloat := func() string {
+		cmds := t.nvim.recorded("vim_command", "nvim_command")
+		for i := len(cmds) - 1; i >= 0; i-- {
+			s := cmds[i].Args[0].(string)
+			const set = "call nvim_buf_set_lines(w:neogo_float_buf, 0, -1, v:true, "
+			if i := strings.Index(s, set); i != -1 {
+				s = s[i+len(set):]
+				return s[:strings.Index(s, ") | ")]
+			}
+		}
+		return ""
+	}
+	check := func(line int, marker string, want ...string) {
+		t.nvim.setCursor(line, marker, 0)
+		c.Assert(t.plug.Hover(nil), IsNil)
+		c.Check(lastFloat(), Equals, vimValue(want))
+	}
+
+	t.nvim.setBuffer(afn, hoverTestSrc)
+	check(16, "T{", "```go", "type T struct{X int}", "```", "package example.com/p/a",
+		"", "T is a thing.", "", "It has [b.B].")
+	check(16, "X:", "```go", "field X int", "```", "package example.com/p/a", "", "X is the x.")
+	check(16, "F(", "```go", "func F(x int) int", "```", "package example.com/p/a", "", "F returns x.")
+	check(14, "b.B", "```go", "package b", "```", "import \"example.com/p/b\"", "", "Package b has B.")
+	check(14, "B }", "```go", "const example.com/p/b.B untyped int", "```", "package example.com/p/b", "", "B is one.")
+	check(14, "int {", "```go", "type int", "```", "builtin")
+
+	// not part of the package, so only parsed
+	t.nvim.setBuffer(ifn, "//go:build ignore\n\npackage a\n\n// G is ignored.\nfunc G() {}\n\nvar y = G")
+	check(8, "G", "```go", "func G()", "```", "package a (syntax only)", "", "G is ignored.")
+}
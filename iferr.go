@@ -0,0 +1,171 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"github.com/myitcv/neovim"
+)
+
+// IfErr inserts an if err != nil block after the statement under the
+// cursor that returns the zero values of the results of the enclosing
+// function or function literal, and the error. err is the error the
+// statement assigns, if it assigns one. Where the statement is a call, the
+// error is wrapped with fmt.Errorf and the name of the function called.
+// A function without an error result panics instead, or in main.main calls
+// log.Fatal. Exposed as NeogoIfErr and :NeogoIfErr
+func (n *Neogo) IfErr(o *neovim.MethodOptionParams) error {
+	return n.report(n.ifErr())
+}
+
+func (n *Neogo) ifErr() error {
+	if err := n.requireFeature(FeatureIfErr); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	p, f, err := n.typeCheck(b)
+	if err != nil {
+		return err
+	}
+	fset := n.ldr.fset
+	// the command is about the line, wherever the cursor is on it. A blank
+	// line is indented as a line that followed the one before would be
+	indent := leadingSpace(b.lines[b.line-1])
+	if strings.TrimSpace(b.lines[b.line-1]) == "" {
+		for l := b.line - 2; l >= 0; l-- {
+			if prev := strings.TrimSpace(b.lines[l]); prev != "" {
+				indent = leadingSpace(b.lines[l])
+				if strings.HasSuffix(prev, "{") || strings.HasSuffix(prev, ":") {
+					indent += "\t"
+				}
+				break
+			}
+		}
+	}
+	pos := filePos(fset, f, b.offset(b.line, len(indent)+1))
+
+	// the statement is the one in the innermost block; on a line of its own
+	// within a block, there is none
+	var sig *types.Signature
+	var stmt ast.Stmt
+	var fname string
+	inBlock := false
+	path := enclosing(f, pos)
+	for i, nd := range path {
+		switch nd := nd.(type) {
+		case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+			inBlock = true
+		case *ast.FuncLit:
+			sig, _ = p.info.Types[nd].Type.(*types.Signature)
+		case *ast.FuncDecl:
+			if fn, ok := p.info.Defs[nd.Name].(*types.Func); ok {
+				sig = fn.Type().(*types.Signature)
+				fname = nd.Name.Name
+			}
+		case ast.Stmt:
+			if stmt == nil && !inBlock && i+1 < len(path) {
+				switch path[i+1].(type) {
+				case *ast.BlockStmt, *ast.CaseClause, *ast.CommClause:
+					stmt = nd
+				}
+			}
+		}
+		if sig != nil {
+			break
+		}
+	}
+	if sig == nil {
+		return fmt.Errorf("not within a function")
+	}
+
+	errName, call := "err", ""
+	at := b.line
+	if stmt != nil {
+		at = fset.Position(stmt.End()).Line
+		if as, ok := stmt.(*ast.AssignStmt); ok {
+			for _, lhs := range as.Lhs {
+				if id, ok := lhs.(*ast.Ident); ok && isError(p.info.ObjectOf(id)) {
+					errName = id.Name
+				}
+			}
+			if c, ok := as.Rhs[0].(*ast.CallExpr); ok && len(as.Rhs) == 1 {
+				if call = calleeName(c); call == "func" {
+					call = ""
+				}
+			}
+		}
+	}
+
+	qual := fileQualifier(p, f)
+	var imp, ret string
+	rs := sig.Results()
+	switch {
+	case rs.Len() > 0 && types.Identical(rs.At(rs.Len()-1).Type(), types.Universe.Lookup("error").Type()):
+		z := zeroer{qual: qual, pkg: p.pkg}
+		var vals []string
+		for i := 0; i < rs.Len()-1; i++ {
+			vals = append(vals, z.value(rs.At(i).Type(), "", 0))
+		}
+		e := errName
+		if call != "" {
+			e = fmt.Sprintf("%v.Errorf(%q, %v)", importedName(p, f, "fmt", &imp), call+": %w", errName)
+		}
+		ret = "return " + strings.Join(append(vals, e), ", ")
+	case fname == "main" && sig.Recv() == nil && p.pkg.Name() == "main":
+		ret = importedName(p, f, "log", &imp) + ".Fatal(" + errName + ")"
+	default:
+		ret = "panic(" + errName + ")"
+	}
+
+	lines := lineEdit{start: at, end: at, lines: []string{
+		indent + "if " + errName + " != nil {",
+		indent + "\t" + ret,
+		indent + "}",
+	}}.apply(b.lines)
+	if imp != "" {
+		ifset := token.NewFileSet()
+		nf, err := parser.ParseFile(ifset, b.name, strings.Join(lines, "\n"), parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+		if e, ok := importEdit(ifset, nf, lines, imp); ok {
+			lines = e.apply(lines)
+		}
+	}
+	return n.applyEdits(lineDiff(b.lines, lines))
+}
+
+// importedName returns the name by which f refers to the package path,
+// setting imp to path if f does not import it, or only as _ or .
+func importedName(p *pkgInfo, f *ast.File, path string, imp *string) string {
+	for _, s := range f.Imports {
+		if importPath(s) != path || unnamedImport(s) {
+			continue
+		}
+		if s.Name != nil {
+			return s.Name.Name
+		}
+		if pn, ok := p.info.Implicits[s].(*types.PkgName); ok {
+			return pn.Name()
+		}
+	}
+	*imp = path
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// isError reports whether obj is a variable of type error
+func isError(obj types.Object) bool {
+	v, ok := obj.(*types.Var)
+	return ok && types.Identical(v.Type(), types.Universe.Lookup("error").Type())
+}
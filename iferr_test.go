@@ -0,0 +1,109 @@
+package neogo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+const ifErrTestSrc = `package main
+
+import "os"
+
+type point struct{ x, y int }
+
+func load(name string) (*point, point, []int, string, error) {
+	f, ferr := os.Open(name)
+	defer f.Close()
+	go func() int {
+		_, err := f.Stat()
+		return 0
+	}()
+
+	return nil, point{}, nil, "", nil
+}
+
+func first[T any](s []T) (T, bool, error) {
+	err := check(
+		len(s),
+	)
+	return s[0], true, err
+}
+
+func check(n int) error { return nil }
+
+func main() {
+	_, err := os.Getwd()
+}`
+
+func (t *PluginTest) TestIfErr(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": ifErrTestSrc + "\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+	afn := filepath.Join(root, "a", "a.go")
+
+	ifErr := func(line int) ([]string, error) {
+		t.nvim.setBuffer(afn, ifErrTestSrc)
+		t.nvim.setCursor(line, "", 0)
+		err := t.plug.IfErr(nil)
+		return t.nvim.bufferLines(), err
+	}
+
+	// zero values for each result; fmt is imported
+	res, err := ifErr(8)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Join(res[:14], "\n"), Equals, `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type point struct{ x, y int }
+
+func load(name string) (*point, point, []int, string, error) {
+	f, ferr := os.Open(name)
+	if ferr != nil {
+		return nil, point{}, nil, "", fmt.Errorf("Open: %w", ferr)
+	}`)
+
+	// in a function literal without an error result
+	res, err = ifErr(11)
+	c.Assert(err, IsNil)
+	c.Assert(res[11:14], DeepEquals, []string{"\t\tif err != nil {", "\t\t\tpanic(err)", "\t\t}"})
+
+	// after the whole statement; a type parameter's zero value
+	res, err = ifErr(19)
+	c.Assert(err, IsNil)
+	c.Assert(res[23:27], DeepEquals, []string{
+		"\t)",
+		"\tif err != nil {",
+		"\t\treturn *new(T), false, fmt.Errorf(\"check: %w\", err)",
+		"\t}",
+	})
+
+	// a blank line in a block, on which there is no statement
+	res, err = ifErr(14)
+	c.Assert(err, IsNil)
+	c.Assert(res[14:17], DeepEquals, []string{"\tif err != nil {", "\t\treturn nil, point{}, nil, \"\", err", "\t}"})
+
+	res, err = ifErr(28)
+	c.Assert(err, IsNil)
+	c.Assert(res[2:6], DeepEquals, []string{"import (", "\t\"log\"", "\t\"os\"", ")"})
+	c.Assert(res[31:34], DeepEquals, []string{"\tif err != nil {", "\t\tlog.Fatal(err)", "\t}"})
+
+	_, err = ifErr(5)
+	c.Assert(err, ErrorMatches, "not within a function")
+
+	// fmt imported as _ gives no name to use, so is imported again
+	t.nvim.setBuffer(afn, strings.Replace(ifErrTestSrc, `import "os"`, "import (\n\t_ \"fmt\"\n\t\"os\"\n)", 1))
+	t.nvim.setCursor(11, "", 0)
+	c.Assert(t.plug.IfErr(nil), IsNil)
+	res = t.nvim.bufferLines()
+	c.Assert(res[2:7], DeepEquals, []string{"import (", "\t_ \"fmt\"", "\t\"fmt\"", "\t\"os\"", ")"})
+	c.Assert(res[13], Equals, "\t\treturn nil, point{}, nil, \"\", fmt.Errorf(\"Open: %w\", ferr)")
+}
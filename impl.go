@@ -0,0 +1,295 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/myitcv/neovim"
+)
+
+// Impl adds stubs for the methods of the interface iface that the type
+// declared under the cursor does not have. iface is a name in the current
+// package, or pkg.Name, where pkg is imported by the file, is found as
+// :NeogoImports would find it, or is an import path. The receiver is named
+// and declared as the type's existing methods have it, and the stubs go
+// after the last of those in the file, or else after the type. Packages the
+// stubs refer to are imported. Exposed as NeogoImpl and :NeogoImpl {iface}
+func (n *Neogo) Impl(o *neovim.MethodOptionParams, iface string) error {
+	return n.report(n.impl(iface))
+}
+
+func (n *Neogo) impl(iface string) error {
+	if err := n.requireFeature(FeatureImpl); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	p, f, err := n.typeCheck(b)
+	if err != nil {
+		return err
+	}
+
+	var spec *ast.TypeSpec
+	var decl ast.Node
+	for _, nd := range enclosing(f, filePos(n.ldr.fset, f, b.offset(b.line, b.col))) {
+		switch nd := nd.(type) {
+		case *ast.TypeSpec:
+			spec = nd
+		case *ast.GenDecl:
+			decl = nd
+		}
+	}
+	if spec == nil {
+		return fmt.Errorf("no type declaration under cursor")
+	}
+	tn, ok := p.info.Defs[spec.Name].(*types.TypeName)
+	if !ok || tn.IsAlias() {
+		return fmt.Errorf("%v is not a defined type", spec.Name.Name)
+	}
+	if tn.Parent() != p.pkg.Scope() {
+		return fmt.Errorf("%v is declared in a function, so cannot have methods", tn.Name())
+	}
+	named := tn.Type().(*types.Named)
+	if types.IsInterface(named) {
+		return fmt.Errorf("%v is an interface", tn.Name())
+	}
+
+	it, err := n.lookupInterface(p, f, filepath.Dir(b.name), iface)
+	if err != nil {
+		return err
+	}
+	var missing []*types.Func
+	for i := 0; i < it.NumMethods(); i++ {
+		m := it.Method(i)
+		if !m.Exported() && m.Pkg() != p.pkg {
+			return fmt.Errorf("%v has unexported method %v", iface, m.Name())
+		}
+		switch obj, _, _ := types.LookupFieldOrMethod(named, true, m.Pkg(), m.Name()); obj := obj.(type) {
+		case nil:
+			missing = append(missing, m)
+		case *types.Var:
+			return fmt.Errorf("%v has a field %v", tn.Name(), m.Name())
+		case *types.Func:
+			// receivers are ignored
+			if !types.Identical(obj.Type(), m.Type()) {
+				qual := types.RelativeTo(p.pkg)
+				return fmt.Errorf("%v.%v has the wrong signature for %v: have %v, want %v", tn.Name(), m.Name(), iface,
+					types.TypeString(obj.Type(), qual), types.TypeString(m.Type(), qual))
+			}
+		}
+	}
+	if missing == nil {
+		return fmt.Errorf("%v already has the methods of %v", tn.Name(), iface)
+	}
+
+	recv, ptr, last := receiverOf(p, tn, f)
+	if recv == "" {
+		recv = receiverName(tn.Name())
+		_, ptr = named.Underlying().(*types.Struct)
+	}
+	after := n.ldr.fset.Position(decl.End()).Line
+	if last != nil {
+		after = n.ldr.fset.Position(last.End()).Line
+	}
+	rt := tn.Name()
+	if tps := named.TypeParams(); tps.Len() > 0 {
+		var ns []string
+		for i := 0; i < tps.Len(); i++ {
+			ns = append(ns, tps.At(i).Obj().Name())
+		}
+		rt += "[" + strings.Join(ns, ", ") + "]"
+	}
+	if ptr {
+		rt = "*" + rt
+	}
+
+	need := make(map[string]bool)
+	fq := fileQualifier(p, f)
+	qual := func(other *types.Package) string {
+		if other != p.pkg && !fileImports(f, other.Path()) {
+			need[other.Path()] = true
+		}
+		return fq(other)
+	}
+	var stubs []string
+	for _, m := range missing {
+		sig := m.Type().(*types.Signature)
+		stubs = append(stubs, "", fmt.Sprintf("func (%v %v) %v%v {", recv, rt, m.Name(), signatureString(sig, recv, qual)), "\tpanic(\"not implemented\")", "}")
+	}
+	lines := lineEdit{start: after, end: after, lines: stubs}.apply(b.lines)
+
+	// the imports are added one at a time to the file as it becomes
+	var paths []string
+	for path := range need {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fset := token.NewFileSet()
+		nf, err := parser.ParseFile(fset, b.name, strings.Join(lines, "\n"), parser.ImportsOnly)
+		if err != nil {
+			return err
+		}
+		if e, ok := importEdit(fset, nf, lines, path); ok {
+			lines = e.apply(lines)
+		}
+	}
+	return n.applyEdits(lineDiff(b.lines, lines))
+}
+
+// lookupInterface returns the interface called name, as Impl takes it,
+// from the point of view of f
+func (n *Neogo) lookupInterface(p *pkgInfo, f *ast.File, dir, name string) (*types.Interface, error) {
+	var obj types.Object
+	if i := strings.LastIndex(name, "."); i < 0 {
+		obj = p.pkg.Scope().Lookup(name)
+		if obj == nil {
+			obj = types.Universe.Lookup(name)
+		}
+	} else {
+		qual, sel := name[:i], name[i+1:]
+		var pkg *types.Package
+		if pn, ok := p.info.Scopes[f].Lookup(qual).(*types.PkgName); ok {
+			pkg = pn.Imported()
+		} else {
+			path := qual
+			if !strings.Contains(qual, "/") {
+				if found, ok := n.findImport(dir, qual, []string{sel}); ok {
+					path = found
+				}
+			}
+			bp, err := n.ldr.resolve(path, dir)
+			if err != nil {
+				return nil, fmt.Errorf("cannot find package %v", qual)
+			}
+			ip, err := n.ldr.checkDir(bp.Dir)
+			if err != nil {
+				return nil, err
+			}
+			if ip.pkg == nil {
+				return nil, fmt.Errorf("cannot load package %v", qual)
+			}
+			pkg = ip.pkg
+		}
+		if obj = pkg.Scope().Lookup(sel); obj != nil && !obj.Exported() && pkg != p.pkg {
+			obj = nil
+		}
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("%v not found", name)
+	}
+	tn, ok := obj.(*types.TypeName)
+	if !ok || !types.IsInterface(tn.Type()) {
+		return nil, fmt.Errorf("%v is not an interface", name)
+	}
+	if nt, ok := tn.Type().(*types.Named); ok && nt.TypeParams().Len() > 0 {
+		return nil, fmt.Errorf("%v is generic", name)
+	}
+	return tn.Type().Underlying().(*types.Interface), nil
+}
+
+// receiverOf returns the receiver name and whether it is a pointer as the
+// methods of tn declare them: the first name given, and a pointer if any
+// method has one. last is the last method declared in f, if any
+func receiverOf(p *pkgInfo, tn *types.TypeName, f *ast.File) (name string, ptr bool, last *ast.FuncDecl) {
+	for _, file := range p.files {
+		for _, d := range file.Decls {
+			fd, ok := d.(*ast.FuncDecl)
+			if !ok || fd.Recv == nil || len(fd.Recv.List) == 0 {
+				continue
+			}
+			fn, ok := p.info.Defs[fd.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+			rt := fn.Type().(*types.Signature).Recv().Type()
+			if pt, ok := rt.(*types.Pointer); ok {
+				rt = pt.Elem()
+			}
+			if nt, ok := rt.(*types.Named); !ok || nt.Obj() != tn {
+				continue
+			}
+			if _, ok := fn.Type().(*types.Signature).Recv().Type().(*types.Pointer); ok {
+				ptr = true
+			}
+			if ns := fd.Recv.List[0].Names; name == "" && len(ns) > 0 && ns[0].Name != "_" {
+				name = ns[0].Name
+			}
+			if file == f {
+				last = fd
+			}
+		}
+	}
+	return name, ptr, last
+}
+
+// receiverName is the receiver name for a type called typ that has no
+// methods: its first letter, lowered
+func receiverName(typ string) string {
+	r, _ := utf8.DecodeRuneInString(typ)
+	return string(unicode.ToLower(r))
+}
+
+// signatureString returns sig as it follows the name in a declaration of a
+// method with receiver recv. Parameters called recv are renamed
+func signatureString(sig *types.Signature, recv string, qual types.Qualifier) string {
+	taken := map[string]bool{recv: true}
+	for _, t := range []*types.Tuple{sig.Params(), sig.Results()} {
+		for i := 0; i < t.Len(); i++ {
+			taken[t.At(i).Name()] = true
+		}
+	}
+	tuple := func(t *types.Tuple, variadic bool) string {
+		var res []string
+		for i := 0; i < t.Len(); i++ {
+			v := t.At(i)
+			s := types.TypeString(v.Type(), qual)
+			if variadic && i == t.Len()-1 {
+				s = "..." + types.TypeString(v.Type().(*types.Slice).Elem(), qual)
+			}
+			if name := v.Name(); name != "" {
+				if name == recv {
+					for j := 1; taken[name]; j++ {
+						name = fmt.Sprintf("%v%v", v.Name(), j)
+					}
+					taken[name] = true
+				}
+				s = name + " " + s
+			}
+			res = append(res, s)
+		}
+		return strings.Join(res, ", ")
+	}
+	res := "(" + tuple(sig.Params(), sig.Variadic()) + ")"
+	switch r := sig.Results(); {
+	case r.Len() == 1 && r.At(0).Name() == "":
+		res += " " + tuple(r, false)
+	case r.Len() > 0:
+		res += " (" + tuple(r, false) + ")"
+	}
+	return res
+}
+
+// fileImports reports whether f imports path
+func fileImports(f *ast.File, path string) bool {
+	for _, s := range f.Imports {
+		if importPath(s) == path {
+			return true
+		}
+	}
+	return false
+}
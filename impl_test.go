@@ -0,0 +1,112 @@
+package neogo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+const implTestSrc = `package a
+
+import "io"
+
+type T struct{}
+
+func (t *T) Read(p []byte) (int, error) {
+	return 0, nil
+}
+
+type V int
+
+var _ io.Reader = (*T)(nil)`
+
+func (t *PluginTest) TestImpl(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": implTestSrc + "\n",
+		"b/b.go": "package b\n\nimport \"io\"\n\ntype Item struct{}\n\ntype Sink interface {\n\tPut(v int, items ...Item) error\n\tOpen(name string) (w io.Writer, err error)\n}\n\ntype StringReader interface {\n\tRead(s string) error\n}\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+	afn := filepath.Join(root, "a", "a.go")
+
+	impl := func(line int, marker, iface string) (string, error) {
+		t.nvim.setBuffer(afn, implTestSrc)
+		t.nvim.setCursor(line, marker, 0)
+		err := t.plug.Impl(nil, iface)
+		return strings.Join(t.nvim.bufferLines(), "\n"), err
+	}
+
+	// the receiver follows Read; Read itself is not repeated
+	res, err := impl(5, "T", "io.ReadWriteCloser")
+	c.Assert(err, IsNil)
+	c.Assert(res, Equals, `package a
+
+import "io"
+
+type T struct{}
+
+func (t *T) Read(p []byte) (int, error) {
+	return 0, nil
+}
+
+func (t *T) Close() error {
+	panic("not implemented")
+}
+
+func (t *T) Write(p []byte) (n int, err error) {
+	panic("not implemented")
+}
+
+type V int
+
+var _ io.Reader = (*T)(nil)`)
+
+	// a package that is not imported yet, and the types it refers to
+	res, err = impl(11, "V", "b.Sink")
+	c.Assert(err, IsNil)
+	c.Assert(res, Equals, `package a
+
+import (
+	"io"
+
+	"example.com/p/b"
+)
+
+type T struct{}
+
+func (t *T) Read(p []byte) (int, error) {
+	return 0, nil
+}
+
+type V int
+
+func (v V) Open(name string) (w io.Writer, err error) {
+	panic("not implemented")
+}
+
+func (v V) Put(v1 int, items ...b.Item) error {
+	panic("not implemented")
+}
+
+var _ io.Reader = (*T)(nil)`)
+
+	_, err = impl(5, "T", "io.Reader")
+	c.Assert(err, ErrorMatches, "T already has the methods of io.Reader")
+	_, err = impl(5, "T", "io.Nope")
+	c.Assert(err, ErrorMatches, "io.Nope not found")
+	_, err = impl(5, "T", "V")
+	c.Assert(err, ErrorMatches, "V is not an interface")
+	_, err = impl(7, "Read", "io.Closer")
+	c.Assert(err, ErrorMatches, "no type declaration under cursor")
+
+	// a method of the name but not the signature is not enough
+	_, err = impl(5, "T", "b.StringReader")
+	c.Assert(err, ErrorMatches, `T.Read has the wrong signature for b.StringReader: have func\(p \[\]byte\) \(int, error\), want func\(s string\) error`)
+
+	// methods cannot be declared on types local to a function
+	t.nvim.setBuffer(afn, implTestSrc+"\n\nfunc f() {\n\ttype L struct{}\n}")
+	t.nvim.setCursor(16, "L", 0)
+	c.Assert(t.plug.Impl(nil, "io.Reader"), ErrorMatches, "L is declared in a function, so cannot have methods")
+}
@@ -0,0 +1,228 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"fmt"
+	"go/types"
+	"sort"
+
+	"github.com/myitcv/neovim"
+)
+
+// Implements fills the quickfix list with, for an interface type under the
+// cursor, the concrete types in the workspace that implement it and, for a
+// concrete type, the interfaces it implements. Exposed as NeogoImplements and
+// :NeogoImplements
+func (n *Neogo) Implements(o *neovim.MethodOptionParams) error {
+	return n.report(n.implements())
+}
+
+// implementation is a type that is related to the one under the cursor by
+// implementing it, or being implemented by it
+type implementation struct {
+	obj *types.TypeName
+
+	// ptr is set when only the pointer type is in the relation, i.e.
+	// methods with pointer receivers are needed
+	ptr bool
+}
+
+func (n *Neogo) implements() error {
+	if err := n.requireFeature(FeatureImplements); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	p, f, err := n.typeCheck(b)
+	if err != nil {
+		return err
+	}
+
+	id, obj := objectAt(p, f, filePos(n.ldr.fset, f, b.offset(b.line, b.col)))
+	if id == nil {
+		return fmt.Errorf("no identifier under cursor")
+	}
+	tn, ok := obj.(*types.TypeName)
+	if !ok {
+		return fmt.Errorf("%v is not a type", id.Name)
+	}
+
+	// a concrete type may implement interfaces declared where it is not,
+	// such as error or fmt.Stringer
+	iface, isIface := types.Unalias(tn.Type()).Underlying().(*types.Interface)
+	universe, err := n.workspaceTypes(p.dir, tn.Pkg(), !isIface)
+	if err != nil {
+		return err
+	}
+
+	qual := types.RelativeTo(p.pkg)
+	name := types.TypeString(tn.Type(), qual)
+	var impls []implementation
+	var title, ptrNote string
+	if isIface {
+		if iface.Empty() {
+			return fmt.Errorf("every type implements %v", tn.Name())
+		}
+		impls = implementationsOf(iface, universe)
+		title = "Implementations of " + name
+	} else {
+		universe = append(universe, types.Universe.Lookup("error").(*types.TypeName))
+		impls = implementedBy(tn, universe)
+		title = "Interfaces implemented by " + name
+		ptrNote = " (via *" + name + ")"
+	}
+
+	items := make([]qfItem, len(impls))
+	for i, im := range impls {
+		text := types.TypeString(im.obj.Type(), qual)
+		if im.ptr {
+			if ptrNote != "" {
+				text += ptrNote
+			} else {
+				text = "*" + text + " (pointer receiver)"
+			}
+		}
+		items[i] = qfItem{pos: n.ldr.fset.Position(im.obj.Pos()), text: text}
+	}
+	n.echo(fmt.Sprintf("%v: %v", title, len(items)))
+	return n.setList(false, title, items)
+}
+
+// workspaceTypes returns the package-level named types declared in every
+// package of the workspace containing dir, in own, if not nil, the package
+// of the type in question and, if imports, in the packages those import.
+// Only those packages are looked at, whatever else the loader has checked,
+// so that the answer does not depend on what was done before
+func (n *Neogo) workspaceTypes(dir string, own *types.Package, imports bool) ([]*types.TypeName, error) {
+	ps, err := n.ldr.checkAll(dir)
+	if err != nil {
+		return nil, err
+	}
+	pkgs := []*types.Package{own}
+	for _, p := range ps {
+		pkgs = append(pkgs, p.pkg)
+	}
+	for _, d := range workspaceDirs(workspaceRoot(dir)) {
+		ps, err := n.ldr.checkAll(d)
+		if err != nil {
+			n.debugf("skipping %v: %v", d, err)
+			continue
+		}
+		for _, p := range ps {
+			pkgs = append(pkgs, p.pkg)
+		}
+	}
+	if imports {
+		for _, pkg := range pkgs {
+			if pkg != nil {
+				pkgs = append(pkgs, pkg.Imports()...)
+			}
+		}
+	}
+
+	seen := make(map[objKey]bool)
+	var res []*types.TypeName
+	for _, pkg := range pkgs {
+		if pkg == nil {
+			continue
+		}
+		s := pkg.Scope()
+		for _, name := range s.Names() {
+			tn, ok := s.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			if nt, ok := tn.Type().(*types.Named); ok && nt.TypeParams().Len() > 0 {
+				// only instantiations can implement anything
+				continue
+			}
+			k := keyOf(n.ldr.fset, tn)
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			res = append(res, tn)
+		}
+	}
+	return res, nil
+}
+
+// implementationsOf returns the concrete types in universe that implement
+// iface, either directly or via their pointer type
+func implementationsOf(iface *types.Interface, universe []*types.TypeName) []implementation {
+	var res []implementation
+	for _, tn := range universe {
+		t := tn.Type()
+		if types.IsInterface(t) {
+			continue
+		}
+		switch {
+		case types.Implements(t, iface):
+			res = append(res, implementation{obj: tn})
+		case isNamedNonPointer(t) && types.Implements(types.NewPointer(t), iface):
+			res = append(res, implementation{obj: tn, ptr: true})
+		}
+	}
+	sortImplementations(res)
+	return res
+}
+
+// implementedBy returns the non-empty interfaces in universe implemented by
+// the type tn or, where pointer receivers are needed, by *tn
+func implementedBy(tn *types.TypeName, universe []*types.TypeName) []implementation {
+	t := tn.Type()
+	var res []implementation
+	for _, it := range universe {
+		iface, ok := it.Type().Underlying().(*types.Interface)
+		if !ok || iface.Empty() || it == tn {
+			continue
+		}
+		if !iface.IsMethodSet() {
+			// constraint interfaces cannot be implemented
+			continue
+		}
+		switch {
+		case types.Implements(t, iface):
+			res = append(res, implementation{obj: it})
+		case isNamedNonPointer(t) && types.Implements(types.NewPointer(t), iface):
+			res = append(res, implementation{obj: it, ptr: true})
+		}
+	}
+	sortImplementations(res)
+	return res
+}
+
+// isNamedNonPointer reports whether t may have methods declared with pointer
+// receivers, i.e. whether *t has a larger method set than t
+func isNamedNonPointer(t types.Type) bool {
+	nt, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return false
+	}
+	_, isPtr := nt.Underlying().(*types.Pointer)
+	return !isPtr
+}
+
+func sortImplementations(impls []implementation) {
+	sort.Sort(implementations(impls))
+}
+
+type implementations []implementation
+
+func (s implementations) Len() int      { return len(s) }
+func (s implementations) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s implementations) Less(i, j int) bool {
+	pi, pj := s[i].obj.Pkg(), s[j].obj.Pkg()
+	if pi != nil && pj != nil && pi.Path() != pj.Path() {
+		return pi.Path() < pj.Path()
+	}
+	if s[i].obj.Name() != s[j].obj.Name() {
+		return s[i].obj.Name() < s[j].obj.Name()
+	}
+	return s[i].obj.Pos() < s[j].obj.Pos()
+}
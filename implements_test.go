@@ -0,0 +1,84 @@
+package neogo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (t *PluginTest) TestImplements(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": "package a\n\ntype Shape interface {\n\tArea() int\n}\n\ntype Sq struct{}\n\nfunc (Sq) Area() int { return 1 }\n\ntype Circ struct{}\n\nfunc (*Circ) Area() int { return 2 }\n",
+		"b/b.go": "package b\n\ntype Areaer interface {\n\tArea() int\n}\n\ntype Other struct{}\n",
+		"c/c.go": cImplementsSrc + "\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+
+	afn := filepath.Join(root, "a", "a.go")
+	bfn := filepath.Join(root, "b", "b.go")
+	src, err := os.ReadFile(afn)
+	c.Assert(err, IsNil)
+
+	item := func(fn string, line, col int, text string) string {
+		return vimValue(map[string]interface{}{"filename": fn, "lnum": line, "col": col, "text": text})
+	}
+	lastList := func() string {
+		cmds := t.nvim.recorded("vim_command", "nvim_command")
+		for i := len(cmds) - 1; i >= 0; i-- {
+			if s := cmds[i].Args[0].(string); strings.HasPrefix(s, "call setqflist(") {
+				return s
+			}
+		}
+		return ""
+	}
+
+	t.nvim.setBuffer(afn, strings.TrimSuffix(string(src), "\n"))
+	t.nvim.setCursor(3, "Shape", 0)
+
+	c.Assert(t.plug.Implements(nil), IsNil)
+	want := "[" + strings.Join([]string{
+		item(afn, 11, 6, "*Circ (pointer receiver)"),
+		item(afn, 7, 6, "Sq"),
+	}, ", ") + "]"
+	c.Assert(strings.Contains(lastList(), want), Equals, true, Commentf("%v", lastList()))
+
+	// packages outside the workspace that happen to have been checked are
+	// not candidates
+	odir := filepath.Join(gopath, "src", "other")
+	c.Assert(os.MkdirAll(odir, 0755), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(odir, "o.go"), []byte("package other\n\ntype Tri struct{}\n\nfunc (Tri) Area() int { return 3 }\n"), 0644), IsNil)
+	_, err = t.plug.ldr.checkDir(odir)
+	c.Assert(err, IsNil)
+	c.Assert(t.plug.Implements(nil), IsNil)
+	c.Assert(strings.Contains(lastList(), want), Equals, true, Commentf("%v", lastList()))
+
+	t.nvim.setCursor(11, "Circ", 0)
+	c.Assert(t.plug.Implements(nil), IsNil)
+	want = "[" + strings.Join([]string{
+		item(afn, 3, 6, "Shape (via *Circ)"),
+		item(bfn, 3, 6, "example.com/p/b.Areaer (via *Circ)"),
+	}, ", ") + "]"
+	c.Assert(strings.Contains(lastList(), want), Equals, true, Commentf("%v", lastList()))
+
+	// as are error, and the interfaces of the packages the workspace imports
+	cfn := filepath.Join(root, "c", "c.go")
+	t.nvim.setBuffer(cfn, cImplementsSrc)
+	t.nvim.setCursor(5, "E", 0)
+	c.Assert(t.plug.Implements(nil), IsNil)
+	for _, text := range []string{"error", "fmt.Stringer"} {
+		c.Assert(strings.Contains(lastList(), "'text': "+vimValue(text)), Equals, true, Commentf("%v", lastList()))
+	}
+}
+
+const cImplementsSrc = `package c
+
+import "fmt"
+
+type E struct{}
+
+func (E) Error() string { return "" }
+
+func (E) String() string { return fmt.Sprint("E") }`
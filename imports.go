@@ -0,0 +1,627 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/myitcv/neovim"
+)
+
+// importUserData prefixes the user_data of completions that need an import
+// added once chosen; the import path follows
+const importUserData = "neogo-import "
+
+// CompleteDone is called when completion finishes with the user_data of the
+// item chosen, if any. Completions of packages that are not yet imported
+// carry their import path, which is then added to the imports of the file.
+// Exposed as NeogoCompleteDone, called on CompleteDone
+func (n *Neogo) CompleteDone(o *neovim.MethodOptionParams, userData string) error {
+	if !strings.HasPrefix(userData, importUserData) {
+		return nil
+	}
+	return n.report(n.addImport(strings.TrimPrefix(userData, importUserData)))
+}
+
+func (n *Neogo) addImport(path string) error {
+	if err := n.requireFeature(FeatureComplete); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	_, f, err := n.typeCheck(b)
+	if err != nil {
+		return err
+	}
+	e, ok := importEdit(n.ldr.fset, f, b.lines, path)
+	if !ok {
+		return nil
+	}
+	return n.applyEdits([]lineEdit{e})
+}
+
+// isStdImport reports whether path is in the standard library, i.e. its
+// first element has no dot
+func isStdImport(path string) bool {
+	return !strings.Contains(strings.SplitN(path, "/", 2)[0], ".")
+}
+
+// importPath returns the unquoted path of s
+func importPath(s *ast.ImportSpec) string {
+	p, _ := strconv.Unquote(s.Path.Value)
+	return p
+}
+
+// unnamedImport reports whether s imports its package as _ or ., giving no
+// name by which to refer to it
+func unnamedImport(s *ast.ImportSpec) bool {
+	return s.Name != nil && (s.Name.Name == "_" || s.Name.Name == ".")
+}
+
+// importEdit returns the edit of lines, the source of f, that adds an import
+// of path, or false if f already imports it other than as _ or . Only lines next to where the
+// import goes are touched: it is placed in sorted order in the first group
+// of the first import block that is, like path, of standard library imports
+// or not, or else in a new group at the top of the block for the standard
+// library and at the bottom otherwise. A single unparenthesized import is
+// turned into a block; a file without imports gets a new import declaration
+// after the package clause
+func importEdit(fset *token.FileSet, f *ast.File, lines []string, path string) (lineEdit, bool) {
+	for _, s := range f.Imports {
+		if importPath(s) == path && !unnamedImport(s) {
+			return lineEdit{}, false
+		}
+	}
+	quoted := strconv.Quote(path)
+	line := func(p token.Pos) int { return fset.Position(p).Line }
+
+	var decls []*ast.GenDecl
+	for _, d := range f.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			break
+		}
+		decls = append(decls, gd)
+	}
+	if len(decls) == 0 {
+		l := line(f.Name.End())
+		return lineEdit{start: l, end: l, lines: []string{"", "import " + quoted}}, true
+	}
+
+	var d, single *ast.GenDecl
+	for _, gd := range decls {
+		if gd.Lparen.IsValid() {
+			d = gd
+			break
+		}
+		if single == nil && importPath(gd.Specs[0].(*ast.ImportSpec)) != "C" {
+			single = gd
+		}
+	}
+	if d == nil && single == nil {
+		// only import "C", whose preamble must stay attached to it
+		l := line(decls[len(decls)-1].End())
+		return lineEdit{start: l, end: l, lines: []string{"", "import " + quoted}}, true
+	}
+	if d == nil {
+		// import "x"; the spec is kept as written, with its comment
+		d = single
+		s := d.Specs[0].(*ast.ImportSpec)
+		l := line(s.Pos())
+		spec := lines[l-1][fset.Position(s.Pos()).Column-1:]
+		res := []string{"import ("}
+		switch std := isStdImport(path); {
+		case std && !isStdImport(importPath(s)):
+			res = append(res, "\t"+quoted, "", "\t"+spec)
+		case !std && isStdImport(importPath(s)):
+			res = append(res, "\t"+spec, "", "\t"+quoted)
+		case importPath(s) < path:
+			res = append(res, "\t"+spec, "\t"+quoted)
+		default:
+			res = append(res, "\t"+quoted, "\t"+spec)
+		}
+		res = append(res, ")")
+		return lineEdit{start: line(d.Pos()) - 1, end: line(s.End()), lines: res}, true
+	}
+
+	// the groups of specs, separated by blank lines
+	var groups [][]*ast.ImportSpec
+	prevEnd := 0
+	for _, sp := range d.Specs {
+		s := sp.(*ast.ImportSpec)
+		start := s.Pos()
+		if s.Doc != nil {
+			start = s.Doc.Pos()
+		}
+		if len(groups) == 0 || line(start) > prevEnd+1 {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], s)
+		prevEnd = line(s.End())
+	}
+
+	indent := "\t"
+	if len(d.Specs) > 0 {
+		l := lines[line(d.Specs[0].Pos())-1]
+		indent = l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+	}
+	for _, g := range groups {
+		if isStdImport(importPath(g[0])) != isStdImport(path) {
+			continue
+		}
+		for _, s := range g {
+			if path < importPath(s) {
+				l := line(s.Pos())
+				if s.Doc != nil {
+					l = line(s.Doc.Pos())
+				}
+				return lineEdit{start: l - 1, end: l - 1, lines: []string{indent + quoted}}, true
+			}
+		}
+		l := line(g[len(g)-1].End())
+		return lineEdit{start: l, end: l, lines: []string{indent + quoted}}, true
+	}
+
+	// no group of its kind; start one
+	if !isStdImport(path) {
+		l := line(d.Rparen) - 1
+		var res []string
+		if len(groups) > 0 {
+			res = append(res, "")
+		}
+		return lineEdit{start: l, end: l, lines: append(res, indent+quoted)}, true
+	}
+	l := line(d.Lparen)
+	res := []string{indent + quoted}
+	if len(groups) > 0 {
+		res = append(res, "")
+	}
+	return lineEdit{start: l, end: l, lines: res}, true
+}
+
+// Imports organizes the imports of the current buffer: those not used are
+// removed, those missing are added, found in the standard library, the
+// workspace and the modules it requires, and all are sorted into groups of
+// standard library, third party and local packages. Only the lines that
+// change are replaced. Exposed as NeogoImports and :NeogoImports
+func (n *Neogo) Imports(o *neovim.MethodOptionParams) error {
+	return n.report(n.organizeImports())
+}
+
+func (n *Neogo) organizeImports() error {
+	if err := n.requireFeature(FeatureImports); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	edits, err := n.importEdits(b)
+	if err != nil {
+		return err
+	}
+	return n.applyEdits(edits)
+}
+
+// importEdits returns the edits of b that organize its imports
+func (n *Neogo) importEdits(b *bufferState) ([]lineEdit, error) {
+	if _, err := parser.ParseFile(token.NewFileSet(), b.name, b.src(), parser.AllErrors); err != nil {
+		// what is missing or unused cannot be trusted
+		return nil, err
+	}
+	p, f, err := n.typeCheck(b)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(b.name)
+	missing := missingImports(p, f)
+	var names, add []string
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if path, ok := n.findImport(dir, name, missing[name]); ok {
+			add = append(add, path)
+		} else {
+			n.debugf("imports: no package %v with %v", name, strings.Join(missing[name], ", "))
+		}
+	}
+
+	out, ok := organizedLines(n.ldr.fset, f, b.lines, unusedImports(p, f), add, n.localPrefixes(dir))
+	if !ok {
+		return nil, nil
+	}
+	return lineDiff(b.lines, out), nil
+}
+
+// localPrefixes returns the import path prefixes of the local group:
+// g:neogo_local_prefix if set, otherwise the path of the module dir is in
+func (n *Neogo) localPrefixes(dir string) []string {
+	var res []string
+	for _, s := range strings.Split(n.config().LocalPrefix, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			res = append(res, s)
+		}
+	}
+	if res == nil {
+		if _, mp := moduleRoot(dir); mp != "" {
+			res = []string{mp}
+		}
+	}
+	return res
+}
+
+// unusedImports returns the imports of f whose package is not referred to.
+// Blank, dot and cgo imports always count as used
+func unusedImports(p *pkgInfo, f *ast.File) map[*ast.ImportSpec]bool {
+	used := make(map[types.Object]bool)
+	for _, obj := range p.info.Uses {
+		if pn, ok := obj.(*types.PkgName); ok {
+			used[pn] = true
+		}
+	}
+	res := make(map[*ast.ImportSpec]bool)
+	for _, s := range f.Imports {
+		if importPath(s) == "C" || s.Name != nil && (s.Name.Name == "_" || s.Name.Name == ".") {
+			continue
+		}
+		obj := p.info.Implicits[s]
+		if s.Name != nil {
+			obj = p.info.Defs[s.Name]
+		}
+		if obj != nil && !used[obj] {
+			res[s] = true
+		}
+	}
+	return res
+}
+
+// missingImports returns the names used as packages in selectors of f that
+// resolve to nothing, with the names selected from each
+func missingImports(p *pkgInfo, f *ast.File) map[string][]string {
+	res := make(map[string][]string)
+	seen := make(map[[2]string]bool)
+	ast.Inspect(f, func(nd ast.Node) bool {
+		sel, ok := nd.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		id, ok := sel.X.(*ast.Ident)
+		if !ok || p.info.Uses[id] != nil || p.info.Defs[id] != nil || inScope(p, id) {
+			return true
+		}
+		if k := [2]string{id.Name, sel.Sel.Name}; !seen[k] {
+			seen[k] = true
+			res[id.Name] = append(res[id.Name], sel.Sel.Name)
+		}
+		return true
+	})
+	return res
+}
+
+// importCandidate is a package that could be imported to supply a name
+type importCandidate struct {
+	name, path, dir string
+}
+
+// findImport returns the import path of the package called name that
+// declares every one of sels, looking in the standard library, then the
+// workspace of dir, then the modules it requires; shorter paths first
+func (n *Neogo) findImport(dir, name string, sels []string) (string, bool) {
+	var std []importCandidate
+	for _, sp := range n.stdlib() {
+		if sp.name == name {
+			std = append(std, importCandidate{name: sp.name, path: sp.path, dir: filepath.Join(n.ldr.ctxt.GOROOT, "src", filepath.FromSlash(sp.path))})
+		}
+	}
+	root := workspaceRoot(dir)
+	for _, cands := range [][]importCandidate{std, n.workspacePackages(root, name), n.dependencyPackages(root, name)} {
+		sort.Sort(byImportPath(cands))
+		for _, c := range cands {
+			if c.dir == dir {
+				continue
+			}
+			p, err := n.ldr.checkDir(c.dir)
+			if err != nil || p.pkg == nil || p.pkg.Name() != name {
+				continue
+			}
+			ok := true
+			for _, s := range sels {
+				if obj := p.pkg.Scope().Lookup(s); obj == nil || !obj.Exported() {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				return c.path, true
+			}
+		}
+	}
+	return "", false
+}
+
+type byImportPath []importCandidate
+
+func (b byImportPath) Len() int      { return len(b) }
+func (b byImportPath) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byImportPath) Less(i, j int) bool {
+	if len(b[i].path) != len(b[j].path) {
+		return len(b[i].path) < len(b[j].path)
+	}
+	return b[i].path < b[j].path
+}
+
+// workspacePackages returns the packages under root called name
+func (n *Neogo) workspacePackages(root, name string) []importCandidate {
+	var res []importCandidate
+	for _, d := range workspaceDirs(root) {
+		if pn := packageName(d); pn == name {
+			res = append(res, importCandidate{name: pn, path: n.ldr.importPath(d), dir: d})
+		}
+	}
+	return res
+}
+
+// dependencyPackages returns the packages called name in the modules
+// required by the go.mod of root, as found in the module cache
+func (n *Neogo) dependencyPackages(root, name string) []importCandidate {
+	mc := n.ldr.modCache()
+	if mc == "" {
+		return nil
+	}
+	var res []importCandidate
+	for _, m := range moduleRequires(root) {
+		mdir := filepath.Join(mc, filepath.FromSlash(escapeModulePath(m[0]))+"@"+m[1])
+		for _, d := range workspaceDirs(mdir) {
+			if pn := packageName(d); pn == name {
+				rel, _ := filepath.Rel(mdir, d)
+				path := m[0]
+				if rel != "." {
+					path += "/" + filepath.ToSlash(rel)
+				}
+				res = append(res, importCandidate{name: pn, path: path, dir: d})
+			}
+		}
+	}
+	return res
+}
+
+// packageName returns the name of the package in dir, from the package
+// clause of its first non-test Go file, or "" if there is none
+func packageName(dir string) string {
+	fns, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, fn := range fns {
+		if strings.HasSuffix(fn, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), fn, nil, parser.PackageClauseOnly)
+		if err == nil && f.Name.Name != "main" {
+			return f.Name.Name
+		}
+	}
+	return ""
+}
+
+// moduleRequires returns the path and version of each module required by
+// the go.mod in root
+func moduleRequires(root string) [][2]string {
+	data, err := ioutil.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return nil
+	}
+	var res [][2]string
+	block := false
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "//"); i != -1 {
+			line = line[:i]
+		}
+		f := strings.Fields(line)
+		switch {
+		case len(f) == 0:
+		case block && f[0] == ")":
+			block = false
+		case block && len(f) >= 2:
+			res = append(res, [2]string{strings.Trim(f[0], `"`), f[1]})
+		case f[0] == "require" && len(f) == 2 && f[1] == "(":
+			block = true
+		case f[0] == "require" && len(f) >= 3:
+			res = append(res, [2]string{strings.Trim(f[1], `"`), f[2]})
+		}
+	}
+	return res
+}
+
+// escapeModulePath escapes path as the module cache does, replacing each
+// upper case letter with ! and its lower case
+func escapeModulePath(path string) string {
+	var buf strings.Builder
+	for _, r := range path {
+		if 'A' <= r && r <= 'Z' {
+			buf.WriteByte('!')
+			r += 'a' - 'A'
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// importLine is an import spec as written, along with the comment lines
+// before it
+type importLine struct {
+	path, name string
+	lines      []string
+}
+
+// importGroup returns the group an import belongs in: 0 for the standard
+// library, 1 for third party packages and 2 for those with a local prefix
+func importGroup(path string, local []string) int {
+	for _, l := range local {
+		if path == l || strings.HasPrefix(path, strings.TrimSuffix(l, "/")+"/") {
+			return 2
+		}
+	}
+	if isStdImport(path) {
+		return 0
+	}
+	return 1
+}
+
+type importLines []importLine
+
+func (l importLines) Len() int      { return len(l) }
+func (l importLines) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l importLines) Less(i, j int) bool {
+	if l[i].path != l[j].path {
+		return l[i].path < l[j].path
+	}
+	return l[i].name < l[j].name
+}
+
+// organizedLines returns lines, the source of f, with the unused imports
+// removed, imports of add added and the imports sorted and grouped. The
+// import declarations are merged into the first; cgo imports, which must
+// stay next to their preamble, are left alone. It returns false if there is
+// nothing it can do, e.g. because imports share a line
+func organizedLines(fset *token.FileSet, f *ast.File, lines []string, unused map[*ast.ImportSpec]bool, add []string, local []string) ([]string, bool) {
+	line := func(p token.Pos) int { return fset.Position(p).Line }
+
+	var decls []*ast.GenDecl
+	for _, d := range f.Decls {
+		gd, ok := d.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			break
+		}
+		if len(gd.Specs) == 1 && importPath(gd.Specs[0].(*ast.ImportSpec)) == "C" {
+			continue
+		}
+		decls = append(decls, gd)
+	}
+
+	var imps []importLine
+	var trailing []string
+	paren := false
+	for _, d := range decls {
+		paren = paren || d.Lparen.IsValid() || len(decls) > 1
+		prev := line(d.Pos())
+		for _, sp := range d.Specs {
+			s := sp.(*ast.ImportSpec)
+			start, end := line(s.Pos()), line(s.End())
+			if start == prev && d.Lparen.IsValid() {
+				return nil, false
+			}
+			var il importLine
+			for l := prev; l < start-1; l++ {
+				if strings.TrimSpace(lines[l]) != "" {
+					il.lines = append(il.lines, lines[l])
+				}
+			}
+			if d.Lparen.IsValid() {
+				il.lines = append(il.lines, lines[start-1:end]...)
+			} else {
+				il.lines = append(il.lines, "\t"+lines[start-1][fset.Position(s.Pos()).Column-1:])
+			}
+			prev = end
+			if unused[s] {
+				continue
+			}
+			il.path = importPath(s)
+			if s.Name != nil {
+				il.name = s.Name.Name
+			}
+			imps = append(imps, il)
+		}
+		if d.Rparen.IsValid() {
+			for _, l := range lines[prev : line(d.Rparen)-1] {
+				if strings.TrimSpace(l) != "" {
+					trailing = append(trailing, l)
+				}
+			}
+		}
+	}
+	for _, path := range add {
+		imps = append(imps, importLine{path: path, lines: []string{"\t" + strconv.Quote(path)}})
+	}
+
+	var groups [3]importLines
+	seen := make(map[[2]string]bool)
+	for _, il := range imps {
+		if k := [2]string{il.path, il.name}; !seen[k] {
+			seen[k] = true
+			g := importGroup(il.path, local)
+			groups[g] = append(groups[g], il)
+		}
+	}
+	var block []string
+	for _, g := range groups {
+		if len(g) == 0 {
+			continue
+		}
+		sort.Sort(g)
+		if block != nil {
+			block = append(block, "")
+		}
+		for _, il := range g {
+			block = append(block, il.lines...)
+		}
+	}
+	block = append(block, trailing...)
+
+	var decl []string
+	switch {
+	case len(block) == 0:
+	case len(block) == 1 && !paren:
+		decl = []string{"import " + strings.TrimSpace(block[0])}
+	default:
+		decl = append(append([]string{"import ("}, block...), ")")
+	}
+
+	if len(decls) == 0 {
+		if decl == nil {
+			return nil, false
+		}
+		// after the package clause, or any cgo imports
+		at := line(f.Name.End())
+		if len(f.Imports) > 0 {
+			at = line(f.Imports[len(f.Imports)-1].End())
+		}
+		res := append([]string{}, lines[:at]...)
+		res = append(append(res, ""), decl...)
+		return append(res, lines[at:]...), true
+	}
+
+	var res []string
+	next := 0
+	for i, d := range decls {
+		start, end := line(d.Pos())-1, line(d.End())
+		if i == 0 && decl != nil {
+			res = append(append(res, lines[next:start]...), decl...)
+			next = end
+			continue
+		}
+		// the whole declaration goes, with its comment, and with one of the
+		// blank lines around it if there are two
+		if d.Doc != nil {
+			start = line(d.Doc.Pos()) - 1
+		}
+		if start > 0 && strings.TrimSpace(lines[start-1]) == "" && end < len(lines) && strings.TrimSpace(lines[end]) == "" {
+			end++
+		}
+		res = append(res, lines[next:start]...)
+		next = end
+	}
+	return append(res, lines[next:]...), true
+}
@@ -0,0 +1,127 @@
+package neogo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (t *PluginTest) TestCompleteImport(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": "package a\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+	afn := filepath.Join(root, "a", "a.go")
+
+	// members of a package not yet imported carry its import
+	src := "package a\n\nimport \"fmt\"\n\nvar _ = fmt.Sprint(strings.)\n"
+	t.nvim.setBuffer(afn, src)
+	t.nvim.setCursor(5, "strings.", len("strings."))
+	res, err := t.plug.Complete(nil, 0, "ToUpper")
+	c.Assert(err, IsNil)
+	c.Assert(res.items, HasLen, 2)
+	c.Assert(res.items[0].word, Equals, "ToUpper")
+	c.Assert(res.items[0].userData, Equals, importUserData+"strings")
+
+	for _, tc := range []struct {
+		src, path, want string
+	}{
+		{
+			"package a\n\nvar x = 1\n",
+			"strings",
+			"package a\n\nimport \"strings\"\n\nvar x = 1\n",
+		},
+		{
+			"package a\n\nimport \"fmt\" // print\n",
+			"strings",
+			"package a\n\nimport (\n\t\"fmt\" // print\n\t\"strings\"\n)\n",
+		},
+		{
+			"package a\n\nimport \"example.com/b\"\n",
+			"fmt",
+			"package a\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/b\"\n)\n",
+		},
+		{
+			"package a\n\nimport (\n\t\"fmt\"\n\t// sorting\n\t\"sort\"\n\n\t\"example.com/b\"\n)\n",
+			"os",
+			"package a\n\nimport (\n\t\"fmt\"\n\t\"os\"\n\t// sorting\n\t\"sort\"\n\n\t\"example.com/b\"\n)\n",
+		},
+		{
+			"package a\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/b\"\n)\n",
+			"strings",
+			"package a\n\nimport (\n\t\"fmt\"\n\t\"strings\"\n\n\t\"example.com/b\"\n)\n",
+		},
+		{
+			"package a\n\nimport (\n\t\"example.com/b\"\n)\n",
+			"fmt",
+			"package a\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/b\"\n)\n",
+		},
+		{
+			"package a\n\nimport \"fmt\"\n",
+			"fmt",
+			"package a\n\nimport \"fmt\"\n",
+		},
+	} {
+		t.nvim.setBuffer(afn, tc.src)
+		c.Assert(t.plug.CompleteDone(nil, importUserData+tc.path), IsNil)
+		c.Assert(strings.Join(t.nvim.bufferLines(), "\n"), Equals, tc.want, Commentf("%q", tc.src))
+	}
+
+	// other completions are left alone
+	t.nvim.setBuffer(afn, "package a\n")
+	c.Assert(t.plug.CompleteDone(nil, ""), IsNil)
+	c.Assert(t.nvim.bufferLines(), DeepEquals, []string{"package a", ""})
+}
+
+func (t *PluginTest) TestImports(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": "package a\n",
+		"b/b.go": "package b\n\nfunc B() int { return 1 }\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+	afn := filepath.Join(root, "a", "a.go")
+
+	// a module required by ours, in the module cache
+	mc := filepath.Join(gopath, "pkg", "mod")
+	dep := filepath.Join(mc, "example.com", "dep@v1.0.0")
+	c.Assert(os.MkdirAll(dep, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dep, "go.mod"), []byte("module example.com/dep\n"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dep, "dep.go"), []byte("package dep\n\nfunc D() int { return 1 }\n"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(root, "go.mod"), []byte("module "+testModule+"\n\nrequire (\n\texample.com/dep v1.0.0 // indirect\n)\n"), 0644), IsNil)
+	defer os.Setenv("GOMODCACHE", os.Getenv("GOMODCACHE"))
+	os.Setenv("GOMODCACHE", mc)
+
+	organize := func(src string) string {
+		t.nvim.setBuffer(afn, src)
+		c.Assert(t.plug.Imports(nil), IsNil)
+		return strings.Join(t.nvim.bufferLines(), "\n")
+	}
+
+	body := "\n\nfunc f() {\n\tfmt.Println(strings.ToUpper(\"x\"), b.B(), dep.D(), os.Args)\n}"
+	src := "package a\n\n// imports\nimport (\n\t\"os\"\n\t// printing\n\t\"fmt\"\n\t\"example.com/p/b\"\n\t\"github.com/x/unused\" // gone\n)" + body
+	c.Assert(organize(src), Equals, "package a\n\n// imports\nimport (\n\t// printing\n\t\"fmt\"\n\t\"os\"\n\t\"strings\"\n\n\t\"example.com/dep\"\n\n\t\"example.com/p/b\"\n)"+body)
+
+	// declarations are merged
+	src = "package a\n\nimport \"os\"\nimport \"fmt\"" + body
+	c.Assert(organize(src), Equals, "package a\n\nimport (\n\t\"fmt\"\n\t\"os\"\n\t\"strings\"\n\n\t\"example.com/dep\"\n\n\t\"example.com/p/b\"\n)"+body)
+
+	c.Assert(organize("package a\n\nfunc f() string { return strings.ToUpper(\"\") }"), Equals,
+		"package a\n\nimport \"strings\"\n\nfunc f() string { return strings.ToUpper(\"\") }")
+	c.Assert(organize("package a\n\nimport \"os\"\n\nfunc f() {}"), Equals, "package a\n\nfunc f() {}")
+	c.Assert(organize("package a\n\nimport _ \"os\"\n\nfunc f() { x.Y() }"), Equals, "package a\n\nimport _ \"os\"\n\nfunc f() { x.Y() }")
+
+	t.nvim.setVar("neogo_local_prefix", "example.com/dep")
+	t.nvim.setVar("neogo_imports_on_save", int64(1))
+	c.Assert(t.plug.ReloadConfig(nil), IsNil)
+	t.nvim.setBuffer(afn, "package a\n\nimport (\n\t\"example.com/dep\"\n\t\"example.com/p/b\"\n)\n\nvar _, _ = dep.D(), b.B()")
+	c.Assert(t.plug.BufferPreWrite(nil, int(t.nvim.curBuf)), IsNil)
+	c.Assert(strings.Join(t.nvim.bufferLines(), "\n"), Equals, "package a\n\nimport (\n\t\"example.com/p/b\"\n\n\t\"example.com/dep\"\n)\n\nvar _, _ = dep.D(), b.B()")
+
+	t.nvim.setBuffer(afn, "package a\n\nfunc f( {")
+	c.Assert(t.plug.Imports(nil), NotNil)
+}
@@ -0,0 +1,577 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// loader type-checks Go packages from source. The contents of files open in
+// Neovim are taken from the overlay in preference to disk. Checked packages
+// are cached by directory until a file in them changes, at which point they
+// and everything that imports them are invalidated.
+//
+// Function bodies are only checked for packages outside GOROOT and the
+// module cache; nothing we offer needs the insides of other people's
+// functions, and skipping them makes checking the standard library cheap.
+type loader struct {
+	mu sync.Mutex
+
+	fset *token.FileSet
+
+	// ctxt resolves import paths. It must not have any file system hooks
+	// set, otherwise go/build falls back to GOPATH-only resolution
+	ctxt build.Context
+
+	overlay  map[string][]byte
+	resolved map[[2]string]*build.Package
+	pkgs     map[string]*pkgInfo
+
+	// stale are the files of invalidated packages, with when they were
+	// invalidated. They are removed from fset once staleAfter has passed,
+	// by when nothing still working with those packages should be looking
+	// up their positions
+	stale map[*token.File]time.Time
+
+	// checking is the set of packages currently being checked, to detect
+	// import cycles
+	checking map[string]bool
+}
+
+// pkgInfo is a type-checked package. Test variants of a package (the package
+// with its _test.go files, and the external _test package) are distinct
+// pkgInfos
+type pkgInfo struct {
+	key  string
+	dir  string
+	path string
+
+	bp    *build.Package
+	files []*ast.File
+	pkg   *types.Package
+	info  *types.Info
+	errs  []error
+
+	// bodies records whether function bodies were checked
+	bodies bool
+
+	// imports are the directories of the packages this package imports
+	imports map[string]bool
+}
+
+func newLoader(ctxt build.Context) *loader {
+	return &loader{
+		fset:     token.NewFileSet(),
+		ctxt:     ctxt,
+		overlay:  make(map[string][]byte),
+		resolved: make(map[[2]string]*build.Package),
+		pkgs:     make(map[string]*pkgInfo),
+		stale:    make(map[*token.File]time.Time),
+		checking: make(map[string]bool),
+	}
+}
+
+// setOverlay records src as the contents of filename, invalidating the
+// package in its directory if the contents changed
+func (l *loader) setOverlay(filename string, src []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if old, ok := l.overlay[filename]; ok && bytes.Equal(old, src) {
+		return
+	}
+	l.overlay[filename] = src
+	l.invalidate(filepath.Dir(filename))
+}
+
+// hasOverlay reports whether there is an overlay for filename
+func (l *loader) hasOverlay(filename string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.overlay[filename]
+	return ok
+}
+
+// clearOverlay drops any overlay for filename, e.g. once it has been saved,
+// invalidating its package
+func (l *loader) clearOverlay(filename string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.overlay, filename)
+	l.invalidate(filepath.Dir(filename))
+}
+
+// invalidate removes the packages in dir, and transitively their importers,
+// from the cache. Called with l.mu held
+func (l *loader) invalidate(dir string) {
+	var gone []string
+	now := time.Now()
+	for k, p := range l.pkgs {
+		if p.dir == dir {
+			delete(l.pkgs, k)
+			gone = append(gone, k)
+			for _, f := range p.files {
+				if tf := l.fset.File(f.Pos()); tf != nil {
+					l.stale[tf] = now
+				}
+			}
+		}
+	}
+	if gone == nil {
+		return
+	}
+	for _, p := range l.pkgs {
+		if p.imports[dir] {
+			l.invalidate(p.dir)
+		}
+	}
+}
+
+// staleAfter is how long the files of an invalidated package are kept in
+// the loader's FileSet
+var staleAfter = time.Minute
+
+// dropStale removes from fset the files that have been stale for longer than
+// staleAfter, so that re-parsing as buffers change does not grow it for the
+// life of the session. Called with l.mu held
+func (l *loader) dropStale() {
+	for tf, t := range l.stale {
+		if time.Since(t) >= staleAfter {
+			l.fset.RemoveFile(tf)
+			delete(l.stale, tf)
+		}
+	}
+}
+
+func (l *loader) readFile(filename string) ([]byte, error) {
+	if src, ok := l.overlay[filename]; ok {
+		return src, nil
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// dirContext returns a build.Context that lists and opens files via the
+// overlay. Called with l.mu held
+func (l *loader) dirContext() build.Context {
+	ctxt := l.ctxt
+	ctxt.ReadDir = func(dir string) ([]os.FileInfo, error) {
+		fis, err := ioutil.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, fi := range fis {
+			seen[fi.Name()] = true
+		}
+		for fn, src := range l.overlay {
+			if filepath.Dir(fn) == dir && !seen[filepath.Base(fn)] {
+				fis = append(fis, overlayFileInfo{name: filepath.Base(fn), size: int64(len(src))})
+			}
+		}
+		return fis, nil
+	}
+	ctxt.OpenFile = func(path string) (io.ReadCloser, error) {
+		if src, ok := l.overlay[path]; ok {
+			return ioutil.NopCloser(bytes.NewReader(src)), nil
+		}
+		return os.Open(path)
+	}
+	return ctxt
+}
+
+type overlayFileInfo struct {
+	name string
+	size int64
+}
+
+func (o overlayFileInfo) Name() string       { return o.name }
+func (o overlayFileInfo) Size() int64        { return o.size }
+func (o overlayFileInfo) Mode() os.FileMode  { return 0644 }
+func (o overlayFileInfo) ModTime() time.Time { return time.Time{} }
+func (o overlayFileInfo) IsDir() bool        { return false }
+func (o overlayFileInfo) Sys() interface{}   { return nil }
+
+// resolve finds the directory of the package imported as path from srcDir.
+// Called with l.mu held
+func (l *loader) resolve(path, srcDir string) (*build.Package, error) {
+	k := [2]string{path, srcDir}
+	if bp, ok := l.resolved[k]; ok {
+		return bp, nil
+	}
+	ctxt := l.ctxt
+	// in module mode, Dir locates the main module
+	ctxt.Dir = srcDir
+	bp, err := ctxt.Import(path, srcDir, build.FindOnly)
+	if err != nil {
+		return nil, err
+	}
+	l.resolved[k] = bp
+	return bp, nil
+}
+
+// importPath returns the import path of the package in dir, based on GOPATH
+// or the enclosing module
+func (l *loader) importPath(dir string) string {
+	for _, root := range append([]string{l.ctxt.GOROOT}, filepath.SplitList(l.ctxt.GOPATH)...) {
+		if root == "" {
+			continue
+		}
+		src := filepath.Join(root, "src") + string(filepath.Separator)
+		if strings.HasPrefix(dir, src) {
+			return filepath.ToSlash(strings.TrimPrefix(dir, src))
+		}
+	}
+	if mod, mp := moduleRoot(dir); mod != "" {
+		rel, _ := filepath.Rel(mod, dir)
+		if rel == "." {
+			return mp
+		}
+		return mp + "/" + filepath.ToSlash(rel)
+	}
+	return dir
+}
+
+// moduleRoot returns the directory containing the go.mod that governs dir,
+// and the module path it declares
+func moduleRoot(dir string) (string, string) {
+	for d := dir; ; d = filepath.Dir(d) {
+		if data, err := ioutil.ReadFile(filepath.Join(d, "go.mod")); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				f := strings.Fields(line)
+				if len(f) >= 2 && f[0] == "module" {
+					return d, strings.Trim(f[1], `"`)
+				}
+			}
+			return d, ""
+		}
+		if filepath.Dir(d) == d {
+			return "", ""
+		}
+	}
+}
+
+// workspaceRoot returns the root of the workspace dir belongs to: the
+// enclosing module, failing that the enclosing repository, failing that dir
+// itself. Searches that go beyond the current package are bounded by it
+func workspaceRoot(dir string) string {
+	if mod, _ := moduleRoot(dir); mod != "" {
+		return mod
+	}
+	for d := dir; filepath.Dir(d) != d; d = filepath.Dir(d) {
+		if fi, err := os.Stat(filepath.Join(d, ".git")); err == nil && fi.IsDir() {
+			return d
+		}
+	}
+	return dir
+}
+
+// workspaceDirs returns every directory under root that could contain a
+// package, skipping those the go tool ignores
+func workspaceDirs(root string) []string {
+	var res []string
+	filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() {
+			return nil
+		}
+		n := fi.Name()
+		if path != root && (strings.HasPrefix(n, ".") || strings.HasPrefix(n, "_") || n == "testdata" || n == "vendor") {
+			return filepath.SkipDir
+		}
+		if path != root {
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				// a nested module is a different workspace
+				return filepath.SkipDir
+			}
+		}
+		res = append(res, path)
+		return nil
+	})
+	return res
+}
+
+// checkBodies reports whether function bodies should be checked for the
+// package in dir
+func (l *loader) checkBodies(dir string) bool {
+	inside := func(root string) bool {
+		return root != "" && strings.HasPrefix(dir, filepath.Clean(root)+string(filepath.Separator))
+	}
+	if inside(l.ctxt.GOROOT) {
+		return false
+	}
+	return !inside(l.modCache())
+}
+
+// modCache returns the directory of the module cache
+func (l *loader) modCache() string {
+	if mc := os.Getenv("GOMODCACHE"); mc != "" {
+		return mc
+	}
+	if gp := filepath.SplitList(l.ctxt.GOPATH); len(gp) > 0 {
+		return filepath.Join(gp[0], "pkg", "mod")
+	}
+	return ""
+}
+
+// checkFile type-checks the package variant that contains filename and
+// returns it along with the file's AST
+func (l *loader) checkFile(filename string) (*pkgInfo, *ast.File, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	dir := filepath.Dir(filename)
+	ctxt := l.dirContext()
+	bp, err := ctxt.ImportDir(dir, 0)
+	if err != nil && bp == nil {
+		return nil, nil, err
+	}
+
+	base := filepath.Base(filename)
+	variant := ""
+	switch {
+	case contains(bp.GoFiles, base), contains(bp.CgoFiles, base):
+	case contains(bp.TestGoFiles, base):
+		variant = "test"
+	case contains(bp.XTestGoFiles, base):
+		variant = "xtest"
+	default:
+		return nil, nil, fmt.Errorf("%v is not part of the package in %v (build constraints?)", base, dir)
+	}
+
+	p, err := l.check(dir, l.importPath(dir), variant)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, f := range p.files {
+		if l.fset.Position(f.Package).Filename == filename {
+			return p, f, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("could not find %v in package %v", filename, p.path)
+}
+
+// checkDir type-checks the package in dir
+func (l *loader) checkDir(dir string) (*pkgInfo, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.check(dir, l.importPath(dir), "")
+}
+
+// checkAll type-checks every variant of the package in dir: the package
+// itself and, where it has tests, the package with its tests and its external
+// test package
+func (l *loader) checkAll(dir string) ([]*pkgInfo, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ctxt := l.dirContext()
+	bp, err := ctxt.ImportDir(dir, 0)
+	if err != nil && bp == nil {
+		return nil, err
+	}
+	path := l.importPath(dir)
+
+	var res []*pkgInfo
+	variants := []string{""}
+	if len(bp.TestGoFiles) > 0 {
+		variants = append(variants, "test")
+	}
+	if len(bp.XTestGoFiles) > 0 {
+		variants = append(variants, "xtest")
+	}
+	for _, v := range variants {
+		p, err := l.check(dir, path, v)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+	}
+	return res, nil
+}
+
+// buildPackage returns the go/build view of the package in dir, seen through
+// the overlay
+func (l *loader) buildPackage(dir string) (*build.Package, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ctxt := l.dirContext()
+	bp, err := ctxt.ImportDir(dir, 0)
+	if err != nil && bp == nil {
+		return nil, err
+	}
+	return bp, nil
+}
+
+// source returns the contents of filename, preferring the overlay
+func (l *loader) source(filename string) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.readFile(filename)
+}
+
+// cached returns the already checked packages; callers must not modify them
+func (l *loader) cached() []*pkgInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	res := make([]*pkgInfo, 0, len(l.pkgs))
+	for _, p := range l.pkgs {
+		res = append(res, p)
+	}
+	return res
+}
+
+func contains(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// check type-checks a variant of the package in dir: "" for the package
+// itself, "test" for the package with its in-package tests, "xtest" for its
+// external test package. Called with l.mu held
+func (l *loader) check(dir, path, variant string) (*pkgInfo, error) {
+	key := dir
+	if variant != "" {
+		key += " [" + variant + "]"
+	}
+	if p, ok := l.pkgs[key]; ok {
+		return p, nil
+	}
+	if len(l.checking) == 0 {
+		l.dropStale()
+	}
+	if l.checking[key] {
+		return nil, fmt.Errorf("import cycle via %v", path)
+	}
+	l.checking[key] = true
+	defer delete(l.checking, key)
+
+	ctxt := l.dirContext()
+	bp, err := ctxt.ImportDir(dir, 0)
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); ok || bp == nil {
+			return nil, err
+		}
+		// e.g. MultiplePackageError; check what we can
+	}
+
+	var names []string
+	switch variant {
+	case "":
+		names = append(append(names, bp.GoFiles...), bp.CgoFiles...)
+	case "test":
+		names = append(append(append(names, bp.GoFiles...), bp.CgoFiles...), bp.TestGoFiles...)
+	case "xtest":
+		names = bp.XTestGoFiles
+		path += "_test"
+	}
+
+	p := &pkgInfo{
+		key:     key,
+		dir:     dir,
+		path:    path,
+		bp:      bp,
+		bodies:  l.checkBodies(dir),
+		imports: make(map[string]bool),
+		info: &types.Info{
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Defs:       make(map[*ast.Ident]types.Object),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Implicits:  make(map[ast.Node]types.Object),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+			Scopes:     make(map[ast.Node]*types.Scope),
+			// for go/analysis analyzers
+			Instances:    make(map[*ast.Ident]types.Instance),
+			FileVersions: make(map[*ast.File]string),
+		},
+	}
+
+	for _, n := range names {
+		fn := filepath.Join(dir, n)
+		src, err := l.readFile(fn)
+		if err != nil {
+			p.errs = append(p.errs, err)
+			continue
+		}
+		f, err := parser.ParseFile(l.fset, fn, src, parser.AllErrors|parser.ParseComments)
+		if f == nil {
+			p.errs = append(p.errs, err)
+			continue
+		}
+		if err != nil {
+			p.errs = append(p.errs, err)
+		}
+		p.files = append(p.files, f)
+	}
+
+	conf := types.Config{
+		IgnoreFuncBodies: !p.bodies,
+		FakeImportC:      true,
+		Error:            func(err error) { p.errs = append(p.errs, err) },
+		Importer: importerFunc(func(ipath, srcDir string) (*types.Package, error) {
+			if ipath == "unsafe" {
+				return types.Unsafe, nil
+			}
+			ibp, err := l.resolve(ipath, srcDir)
+			if err != nil {
+				return nil, err
+			}
+			if variant == "xtest" && ibp.Dir == dir {
+				// the package under test, with its in-package tests
+				ip, err := l.check(dir, ibp.ImportPath, "test")
+				if err != nil {
+					return nil, err
+				}
+				p.imports[ip.dir] = true
+				return ip.pkg, nil
+			}
+			ip, err := l.check(ibp.Dir, ibp.ImportPath, "")
+			if err != nil {
+				return nil, err
+			}
+			p.imports[ip.dir] = true
+			return ip.pkg, nil
+		}),
+		Sizes: types.SizesFor("gc", l.ctxt.GOARCH),
+	}
+
+	// errors are collected by conf.Error; we always want the (partial)
+	// package
+	p.pkg, _ = conf.Check(path, l.fset, p.files, p.info)
+
+	l.pkgs[key] = p
+	return p, nil
+}
+
+type importerFunc func(path, srcDir string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) {
+	return f(path, "")
+}
+
+func (f importerFunc) ImportFrom(path, srcDir string, mode types.ImportMode) (*types.Package, error) {
+	return f(path, srcDir)
+}
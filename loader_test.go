@@ -0,0 +1,180 @@
+package neogo
+
+import (
+	"fmt"
+	"go/build"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type LoaderTest struct {
+	gopath string
+	ldr    *loader
+}
+
+var _ = Suite(&LoaderTest{})
+
+// testModule is the import path (and module path) of the trees written by
+// writeTree
+const testModule = "example.com/p"
+
+// writeTree writes files, keyed by slash-separated path relative to the
+// testModule root, into a new temporary GOPATH, adding a go.mod so that the
+// tree works whether or not modules are enabled. It returns the GOPATH and
+// the module root
+func writeTree(c *C, files map[string]string) (string, string) {
+	gopath, err := ioutil.TempDir("", "neogo-test")
+	c.Assert(err, IsNil)
+	// so that positions compare equal to what build reports
+	gopath, err = filepath.EvalSymlinks(gopath)
+	c.Assert(err, IsNil)
+
+	root := filepath.Join(gopath, "src", filepath.FromSlash(testModule))
+	files["go.mod"] = "module " + testModule + "\n"
+	for fn, src := range files {
+		fn = filepath.Join(root, filepath.FromSlash(fn))
+		c.Assert(os.MkdirAll(filepath.Dir(fn), 0755), IsNil)
+		c.Assert(ioutil.WriteFile(fn, []byte(src), 0644), IsNil)
+	}
+	return gopath, root
+}
+
+// testLoader returns a loader that resolves imports in gopath
+func testLoader(gopath string) *loader {
+	ctxt := build.Default
+	ctxt.GOPATH = gopath
+	return newLoader(ctxt)
+}
+
+func (t *LoaderTest) TearDownTest(c *C) {
+	if t.gopath != "" {
+		os.RemoveAll(t.gopath)
+		t.gopath = ""
+	}
+}
+
+func (t *LoaderTest) setUp(c *C, files map[string]string) string {
+	gopath, root := writeTree(c, files)
+	t.gopath = gopath
+	t.ldr = testLoader(gopath)
+	return root
+}
+
+func (t *LoaderTest) TestCheckFile(c *C) {
+	root := t.setUp(c, map[string]string{
+		"a/a.go": "package a\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/p/b\"\n)\n\nfunc A() { fmt.Println(b.B()) }\n",
+		"b/b.go": "package b\n\nfunc B() int { return 1 }\n",
+	})
+
+	p, f, err := t.ldr.checkFile(filepath.Join(root, "a", "a.go"))
+	c.Assert(err, IsNil)
+	c.Assert(p.errs, HasLen, 0)
+	c.Assert(p.path, Equals, testModule+"/a")
+	c.Assert(f.Name.Name, Equals, "a")
+	c.Assert(p.bodies, Equals, true)
+	c.Assert(p.imports[filepath.Join(root, "b")], Equals, true)
+
+	// the standard library is checked without bodies
+	for _, q := range t.ldr.cached() {
+		if q.path == "fmt" {
+			c.Assert(q.bodies, Equals, false)
+		}
+	}
+}
+
+func (t *LoaderTest) TestOverlay(c *C) {
+	root := t.setUp(c, map[string]string{
+		"a/a.go": "package a\n\nimport \"example.com/p/b\"\n\nvar _ int = b.B()\n",
+		"b/b.go": "package b\n\nfunc B() int { return 1 }\n",
+	})
+	afn := filepath.Join(root, "a", "a.go")
+
+	p, _, err := t.ldr.checkFile(afn)
+	c.Assert(err, IsNil)
+	c.Assert(p.errs, HasLen, 0)
+
+	// an unsaved change to b is seen by a
+	t.ldr.setOverlay(filepath.Join(root, "b", "b.go"), []byte("package b\n\nfunc B() string { return \"\" }\n"))
+	p, _, err = t.ldr.checkFile(afn)
+	c.Assert(err, IsNil)
+	c.Assert(p.errs, HasLen, 1)
+	c.Assert(p.errs[0], ErrorMatches, ".*cannot use b.B\\(\\).*")
+
+	// as is a file that only exists in the overlay
+	t.ldr.setOverlay(filepath.Join(root, "b", "c.go"), []byte("package b\n\nfunc C() {}\n"))
+	t.ldr.setOverlay(afn, []byte("package a\n\nimport \"example.com/p/b\"\n\nfunc init() { b.C() }\n"))
+	p, _, err = t.ldr.checkFile(afn)
+	c.Assert(err, IsNil)
+	c.Assert(p.errs, HasLen, 0)
+
+	t.ldr.clearOverlay(filepath.Join(root, "b", "c.go"))
+	p, _, err = t.ldr.checkFile(afn)
+	c.Assert(err, IsNil)
+	c.Assert(p.errs, HasLen, 1)
+}
+
+func (t *LoaderTest) TestStaleFiles(c *C) {
+	root := t.setUp(c, map[string]string{
+		"a/a.go": "package a\n\nfunc A() {}\n",
+	})
+	afn := filepath.Join(root, "a", "a.go")
+	files := func() int {
+		n := 0
+		t.ldr.fset.Iterate(func(*token.File) bool { n++; return true })
+		return n
+	}
+
+	_, _, err := t.ldr.checkFile(afn)
+	c.Assert(err, IsNil)
+	c.Assert(files(), Equals, 1)
+
+	// superseded files are kept for a while, for whoever is still using them
+	t.ldr.setOverlay(afn, []byte("package a\n\nfunc B() {}\n"))
+	_, _, err = t.ldr.checkFile(afn)
+	c.Assert(err, IsNil)
+	c.Assert(files(), Equals, 2)
+
+	defer func(d time.Duration) { staleAfter = d }(staleAfter)
+	staleAfter = 0
+	for i := 0; i < 3; i++ {
+		t.ldr.setOverlay(afn, []byte(fmt.Sprintf("package a\n\nvar V = %v\n", i)))
+		p, _, err := t.ldr.checkFile(afn)
+		c.Assert(err, IsNil)
+		c.Assert(p.pkg.Scope().Lookup("V"), NotNil)
+		c.Assert(files(), Equals, 1)
+	}
+}
+
+func (t *LoaderTest) TestTestVariants(c *C) {
+	root := t.setUp(c, map[string]string{
+		"a/a.go":        "package a\n\nfunc A() int { return helper() }\n",
+		"a/a_test.go":   "package a\n\nfunc helper() int { return 1 }\n",
+		"a/ax_test.go":  "package a_test\n\nimport \"example.com/p/a\"\n\nvar _ = a.A()\n",
+		"a/ignored.go":  "// +build ignore\n\npackage a\n",
+		"a/doc_test.go": "package a\n",
+	})
+
+	// without its tests, a does not compile
+	p, err := t.ldr.checkDir(filepath.Join(root, "a"))
+	c.Assert(err, IsNil)
+	c.Assert(p.errs, HasLen, 1)
+
+	p, _, err = t.ldr.checkFile(filepath.Join(root, "a", "a_test.go"))
+	c.Assert(err, IsNil)
+	c.Assert(p.errs, HasLen, 0)
+
+	p, _, err = t.ldr.checkFile(filepath.Join(root, "a", "ax_test.go"))
+	c.Assert(err, IsNil)
+	c.Assert(p.errs, HasLen, 0)
+	c.Assert(p.path, Equals, testModule+"/a_test")
+
+	_, _, err = t.ldr.checkFile(filepath.Join(root, "a", "ignored.go"))
+	c.Assert(err, NotNil)
+	c.Assert(strings.Contains(err.Error(), "build constraints"), Equals, true)
+}
@@ -10,7 +10,10 @@ package neogo
 
 import (
 	"fmt"
+	"go/build"
 	"strings"
+	"sync"
+	"time"
 
 	"go/ast"
 	"go/parser"
@@ -20,37 +23,112 @@ import (
 )
 
 type Neogo struct {
-	c  *neovim.Client
-	l  neovim.Logger
-	ch chan struct{}
-}
+	// Base, if set before Init, is the configuration onto which the
+	// g:neogo_* variables are applied. DefaultConfig() otherwise.
+	Base *Config
+
+	c    *neovim.Client
+	l    neovim.Logger
+	ch   chan struct{}
+	sig  chan struct{}
+	done chan struct{}
+
+	mu  sync.Mutex
+	cfg Config
+
+	// ldr type-checks the packages of the buffers we are asked about
+	ldr *loader
 
-var fDebugAST bool
-var fDebug bool
+	// outlines holds the buffers for which an outline has been shown, and
+	// is to be kept up to date. Guarded by mu
+	outlines map[string]bool
+
+	// indexes are the symbol indexes by workspace root. Guarded by mu
+	indexes map[string]*symbolIndex
+
+	// calls is the call tree last shown. Guarded by mu
+	calls *callTreeState
+
+	// std lists the standard library packages, found once
+	stdlibOnce sync.Once
+	std        []stdPackage
+}
 
 func (n *Neogo) Init(c *neovim.Client, l neovim.Logger) error {
 	n.c = c
 	n.l = l
 
+	cfg, err := n.loadConfig()
+	n.setConfig(cfg)
+	if err != nil {
+		n.errorf("config: %v", err)
+	}
+
 	// we want to know when the buffer changes. We do this in a few steps, which
 	// are necessarily "out of order"
 
 	n.c.RegisterAsyncFunction("BufferUpdate", n.newBufferUpdateResponder, false, false)
 	// com := fmt.Sprintf(`au TextChanged,TextChangedI <buffer> call BufferUpdate()`)
 	// c.Command(com)
-
-	n.ch = make(chan struct{})
-	go n.parseBuffer(n.ch)
+	n.c.RegisterAsyncFunction("BufferWrite", n.newBufferWriteResponder, false, false)
+	n.c.RegisterAsyncFunction("BufferEnter", n.newBufferEnterResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoReloadConfig", n.newReloadConfigResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoDefinition", n.newDefinitionResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoReferences", n.newReferencesResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoImplements", n.newImplementsResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoOutline", n.newOutlineResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoSymbols", n.newSymbolsResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoCallers", n.newCallersResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoCallees", n.newCalleesResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoCallTreeToggle", n.newCallTreeToggleResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoCallTreeJump", n.newCallTreeJumpResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoHover", n.newHoverResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoSignatureHelp", n.newSignatureHelpResponder, false, false)
+	n.c.RegisterSyncFunction("NeogoComplete", n.newCompleteResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoCompleteDone", n.newCompleteDoneResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoFmt", n.newFmtResponder, false, false)
+	n.c.RegisterSyncFunction("BufferPreWrite", n.newBufferPreWriteResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoImports", n.newImportsResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoRename", n.newRenameResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoExtractFunc", n.newExtractFuncResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoExtractVar", n.newExtractVarResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoFillStruct", n.newFillStructResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoImpl", n.newImplResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoAddTags", n.newAddTagsResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoRemoveTags", n.newRemoveTagsResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoIfErr", n.newIfErrResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoCodeAction", n.newCodeActionResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoAlternate", n.newAlternateResponder, false, false)
+	n.c.RegisterAsyncFunction("NeogoGenTest", n.newGenTestResponder, false, false)
+
+	n.ldr = newLoader(build.Default)
+
+	// buffered so that BufferUpdate never blocks; updates that arrive while
+	// one is pending are coalesced
+	n.ch = make(chan struct{}, 1)
+	n.sig = make(chan struct{}, 1)
+	n.done = make(chan struct{})
+	go n.parseBuffer(n.ch, n.done)
+	go n.signatureLoop(n.sig, n.done)
 
 	return nil
 }
 
 func (n *Neogo) Shutdown() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.done != nil {
+		close(n.done)
+		n.done = nil
+	}
 	return nil
 }
 
 func (n *Neogo) BufferUpdate(o *neovim.MethodOptionParams) error {
-	n.ch <- struct{}{}
+	select {
+	case n.ch <- struct{}{}:
+	default:
+	}
 	return nil
 }
 
@@ -67,49 +145,71 @@ func getUint64(i interface{}) uint64 {
 	}
 }
 
-func (n *Neogo) parseBuffer(ch chan struct{}) {
+func (n *Neogo) parseBuffer(ch, done chan struct{}) {
 	// Consume events, parse and send back commands to highlight
 	sg := NewSynGenerator()
+	var debounce <-chan time.Time
 	for {
 		select {
 		case <-ch:
-			cb, _ := n.c.GetCurrentBuffer()
-			bn, _ := cb.GetName()
-			bc, _ := cb.GetLineSlice(0, -1, true, true)
-			src := []byte(strings.Join(bc, "\n"))
-
-			viewPortI, err := n.c.Eval("[winsaveview()['topline'], winsaveview()['topline'] + winheight('%'), winsaveview()['leftcol'], winsaveview()['leftcol'] + winwidth('%')]")
-			viewPort := viewPortI.([]interface{})
-			sg.lStart = getUint64(viewPort[0])
-			sg.lEnd = getUint64(viewPort[1])
-			sg.cStart = getUint64(viewPort[2])
-			sg.cEnd = getUint64(viewPort[3])
-
-			fset := token.NewFileSet()
-			f, err := parser.ParseFile(fset, bn, src, parser.AllErrors|parser.ParseComments)
-			if f == nil && err != nil {
-				fmt.Println("We got an error on the parse")
-			}
+			debounce = time.After(n.config().Debounce)
+		case <-debounce:
+			debounce = nil
+			n.highlight(sg)
+			n.refreshOutline()
+		case <-done:
+			return
+		}
+	}
+}
 
-			if fDebugAST {
-				ast.Print(fset, f)
-			}
+func (n *Neogo) highlight(sg *synGenerator) {
+	cfg := n.config()
 
-			// TODO better way? Do we really need to reparse each time?
-			sg.fset = fset
-			sg.f = f
+	if !cfg.Enabled(FeatureHighlight) {
+		// clear anything we previously added
+		sg.sweepMap(n)
+		return
+	}
 
-			// generate our highlight positions
-			ast.Walk(sg, f)
+	cb, _ := n.c.GetCurrentBuffer()
+	bn, _ := cb.GetName()
+	bc, _ := cb.GetLineSlice(0, -1, true, true)
+	src := []byte(strings.Join(bc, "\n"))
 
-			for _, c := range f.Comments {
-				ast.Walk(sg, c)
-			}
+	if cfg.MaxFileSize > 0 && len(src) > cfg.MaxFileSize {
+		n.debugf("%v is %v bytes, larger than max_file_size %v; not highlighting", bn, len(src), cfg.MaxFileSize)
+		sg.sweepMap(n)
+		return
+	}
 
-			// set the highlights
-			sg.sweepMap(n)
-		}
+	if cfg.Semantic {
+		n.c.Command("if &l:syntax !=# '' | setlocal syntax= | endif")
+	}
+
+	viewPortI, err := n.c.Eval("[winsaveview()['topline'], winsaveview()['topline'] + winheight('%'), winsaveview()['leftcol'], winsaveview()['leftcol'] + winwidth('%')]")
+	viewPort := viewPortI.([]interface{})
+	sg.lStart = getUint64(viewPort[0])
+	sg.lEnd = getUint64(viewPort[1])
+	sg.cStart = getUint64(viewPort[2])
+	sg.cEnd = getUint64(viewPort[3])
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, bn, src, parser.AllErrors|parser.ParseComments)
+	if f == nil && err != nil {
+		n.errorf("We got an error on the parse: %v", err)
+		return
+	}
+
+	if cfg.DebugAST {
+		ast.Print(fset, f)
 	}
+
+	// generate our highlight positions
+	sg.generate(fset, f)
+
+	// set the highlights
+	sg.sweepMap(n)
 }
 
 type position struct {
@@ -190,29 +290,63 @@ func NewSynGenerator() *synGenerator {
 	return res
 }
 
-func (s *synGenerator) sweepMap(n *Neogo) {
+// generate walks f, including its comments, recording a node for every
+// position that should be highlighted
+func (s *synGenerator) generate(fset *token.FileSet, f *ast.File) {
+	// TODO better way? Do we really need to reparse each time?
+	s.fset = fset
+	s.f = f
+
+	ast.Walk(s, f)
+
+	for _, c := range f.Comments {
+		ast.Walk(s, c)
+	}
+}
+
+// matcher is what synGenerator needs of an editor to maintain its highlights:
+// the ability to add a match for a span and later delete it again by id. The
+// Neogo implementation talks to Neovim; tests use an in-memory one.
+type matcher interface {
+	addMatch(class string, line, col, l int) (uint64, error)
+	deleteMatch(id uint64) error
+}
+
+func (n *Neogo) addMatch(class string, line, col, l int) (uint64, error) {
+	com := fmt.Sprintf("matchaddpos('%v', [[%v,%v,%v]])", class, line, col, l)
+	id, err := n.c.Eval(com)
+	if err != nil {
+		return 0, err
+	}
+	switch id := id.(type) {
+	case uint64:
+		return id, nil
+	case int64:
+		return uint64(id), nil
+	}
+	return 0, fmt.Errorf("unexpected result from %v: %T", com, id)
+}
+
+func (n *Neogo) deleteMatch(id uint64) error {
+	com := fmt.Sprintf("matchdelete(%v)", id)
+	_, err := n.c.Eval(com)
+	n.debugf("%v", com)
+	return err
+}
+
+func (s *synGenerator) sweepMap(mr matcher) {
 	for pos, m := range s.nodes {
 		switch m.a {
 		case _ADD:
-			com := fmt.Sprintf("matchaddpos('%v', [[%v,%v,%v]])", pos.t, pos.line, pos.col, pos.l)
-			id, _ := n.c.Eval(com)
-			switch id := id.(type) {
-			case uint64:
-				m.id = id
-			case int64:
-				m.id = uint64(id)
-			}
+			m.id, _ = mr.addMatch(pos.t.String(), pos.line, pos.col, pos.l)
 			m.a = _DELETE
 		case _DELETE:
 			if m.id == 0 {
 				// this match never got added
+				delete(s.nodes, pos)
 				continue
 			}
-			com := fmt.Sprintf("matchdelete(%v)", m.id)
-			n.c.Eval(com)
-			if fDebug {
-				fmt.Printf("%v\n", com)
-			}
+			mr.deleteMatch(m.id)
 			delete(s.nodes, pos)
 		case _KEEP:
 			m.a = _DELETE
@@ -221,6 +355,11 @@ func (s *synGenerator) sweepMap(n *Neogo) {
 }
 
 func (s *synGenerator) addNode(t nodeType, l int, _p token.Pos) {
+	// positions the parser leaves unset, e.g. the func of an interface
+	// method's type, have nothing to highlight
+	if !_p.IsValid() {
+		return
+	}
 	p := s.fset.Position(_p)
 	if uint64(p.Line) < s.lStart || uint64(p.Line) > s.lEnd {
 		return
@@ -229,8 +368,12 @@ func (s *synGenerator) addNode(t nodeType, l int, _p token.Pos) {
 	if m, ok := s.nodes[pos]; ok {
 		// when we call add, we mark the match as delete
 		// for efficiency next time around, hence the need
-		// to mark this as keep
-		m.a = _KEEP
+		// to mark this as keep. A node can be visited twice in one
+		// walk (doc comments are also in f.Comments), in which case it
+		// may still be waiting to be added
+		if m.a == _DELETE {
+			m.a = _KEEP
+		}
 	} else {
 		// we leave anything that needs to be deleted
 		// and add a new match, with action == _ADD
@@ -304,12 +447,8 @@ func (s *synGenerator) Visit(node ast.Node) ast.Visitor {
 	case *ast.CaseClause:
 		s.addNode(_LABEL, 4, node.Case)
 	case *ast.RangeStmt:
-		// TODO is this always safe to do?
 		s.addNode(_REPEAT, 3, node.For)
-		key := node.Key.(*ast.Ident)
-		ass := key.Obj.Decl.(*ast.AssignStmt)
-		rhs := ass.Rhs[0].(*ast.UnaryExpr)
-		s.addNode(_REPEAT, 5, rhs.OpPos)
+		s.addNode(_REPEAT, 5, node.Range)
 	case *ast.IfStmt:
 		s.addNode(_CONDITIONAL, 2, node.If)
 		// TODO need to find a way to add else highlighting
@@ -0,0 +1,216 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/myitcv/neovim"
+)
+
+// Outline fills the location list of the current window with the top-level
+// declarations of the current buffer: consts, vars, funcs and types, each
+// type followed by its methods. <CR> in the location list window jumps to
+// the declaration, and the list is refreshed as the buffer changes. Exposed
+// as NeogoOutline and :NeogoOutline
+func (n *Neogo) Outline(o *neovim.MethodOptionParams) error {
+	return n.report(n.outline())
+}
+
+func (n *Neogo) outline() error {
+	if err := n.requireFeature(FeatureOutline); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	items, err := outlineItems(b.name, b.src())
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	if n.outlines == nil {
+		n.outlines = make(map[string]bool)
+	}
+	n.outlines[b.name] = true
+	n.mu.Unlock()
+
+	return n.setList(true, outlineTitle(b.name), items)
+}
+
+// refreshOutline replaces the outline of the current buffer, if one was
+// asked for and it is still the current window's location list
+func (n *Neogo) refreshOutline() {
+	if !n.config().Enabled(FeatureOutline) {
+		return
+	}
+	cb, err := n.c.GetCurrentBuffer()
+	if err != nil {
+		return
+	}
+	bn, err := cb.GetName()
+	if err != nil || bn == "" {
+		return
+	}
+	if bn, err = filepath.Abs(bn); err != nil {
+		return
+	}
+	n.mu.Lock()
+	open := n.outlines[bn]
+	n.mu.Unlock()
+	if !open {
+		return
+	}
+
+	bc, err := cb.GetLineSlice(0, -1, true, true)
+	if err != nil {
+		return
+	}
+	b := &bufferState{name: bn, lines: bc}
+	items, err := outlineItems(bn, b.src())
+	if err != nil {
+		n.debugf("outline of %v: %v", bn, err)
+		return
+	}
+
+	title := vimString(outlineTitle(bn))
+	n.c.Command("if getloclist(0, {'title': 0}).title ==# " + title +
+		" | call setloclist(0, [], 'r', " + listWhat(outlineTitle(bn), items) + ") | endif")
+}
+
+func outlineTitle(filename string) string {
+	return "Outline of " + filepath.Base(filename)
+}
+
+// outlineItems parses src and returns its top-level declarations in the
+// order of go doc: consts, vars, funcs, then each type with its methods.
+// Methods on types not declared in src come last, grouped by receiver
+func outlineItems(filename string, src []byte) ([]qfItem, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, parser.SkipObjectResolution)
+	if f == nil {
+		return nil, err
+	}
+
+	var consts, vars, funcs, types []qfItem
+	var typeNames []string
+	methods := make(map[string][]qfItem)
+	var recvs []string
+
+	item := func(pos token.Pos, text string) qfItem {
+		return qfItem{pos: fset.Position(pos), text: text}
+	}
+
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.GenDecl:
+			for _, s := range d.Specs {
+				switch s := s.(type) {
+				case *ast.ValueSpec:
+					for _, id := range s.Names {
+						if id.Name == "_" {
+							continue
+						}
+						if d.Tok == token.CONST {
+							consts = append(consts, item(id.Pos(), "const "+id.Name))
+						} else {
+							vars = append(vars, item(id.Pos(), "var "+id.Name))
+						}
+					}
+				case *ast.TypeSpec:
+					types = append(types, item(s.Name.Pos(), "type "+s.Name.Name+typeSummary(fset, s)))
+					typeNames = append(typeNames, s.Name.Name)
+				}
+			}
+		case *ast.FuncDecl:
+			sig := funcSignature(fset, d)
+			if d.Recv == nil || len(d.Recv.List) == 0 {
+				funcs = append(funcs, item(d.Name.Pos(), sig))
+				continue
+			}
+			r := recvTypeName(d.Recv.List[0].Type)
+			if _, ok := methods[r]; !ok {
+				recvs = append(recvs, r)
+			}
+			methods[r] = append(methods[r], item(d.Name.Pos(), sig))
+		}
+	}
+
+	res := append(append(consts, vars...), funcs...)
+	for i, t := range types {
+		res = append(res, t)
+		for _, m := range methods[typeNames[i]] {
+			m.text = "  " + m.text
+			res = append(res, m)
+		}
+		delete(methods, typeNames[i])
+	}
+	sort.Strings(recvs)
+	for _, r := range recvs {
+		res = append(res, methods[r]...)
+	}
+	return res, nil
+}
+
+// typeSummary describes the type declared by s briefly: the keyword for
+// struct and interface types, otherwise the type itself
+func typeSummary(fset *token.FileSet, s *ast.TypeSpec) string {
+	var res string
+	if s.Assign.IsValid() {
+		res = " ="
+	}
+	switch s.Type.(type) {
+	case *ast.StructType:
+		return res + " struct"
+	case *ast.InterfaceType:
+		return res + " interface"
+	}
+	return res + " " + nodeString(fset, s.Type)
+}
+
+// funcSignature returns the declaration of d without its body or doc
+func funcSignature(fset *token.FileSet, d *ast.FuncDecl) string {
+	sig := *d
+	sig.Doc, sig.Body = nil, nil
+	return nodeString(fset, &sig)
+}
+
+// recvTypeName returns the name of the type in the receiver expression e
+func recvTypeName(e ast.Expr) string {
+	for {
+		switch t := e.(type) {
+		case *ast.StarExpr:
+			e = t.X
+		case *ast.ParenExpr:
+			e = t.X
+		case *ast.IndexExpr:
+			e = t.X
+		case *ast.IndexListExpr:
+			e = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// nodeString formats node on a single line
+func nodeString(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
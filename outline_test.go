@@ -0,0 +1,65 @@
+package neogo
+
+import (
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+const outlineTestSrc = `package p
+
+type T struct{}
+
+func (t *T) M() {}
+
+const C = 1
+
+func F(a int) error { return nil }
+
+var V, _ = 1, 2
+
+func (s S) N() {}
+
+type I interface{ M() }`
+
+func (t *PluginTest) TestOutline(c *C) {
+	const fn = "/tmp/o.go"
+	t.nvim.setBuffer(fn, outlineTestSrc)
+
+	item := func(line, col int, text string) string {
+		return vimValue(map[string]interface{}{"filename": fn, "lnum": line, "col": col, "text": text})
+	}
+	lastList := func(action string) string {
+		cmds := t.nvim.recorded("vim_command", "nvim_command")
+		for i := len(cmds) - 1; i >= 0; i-- {
+			s := cmds[i].Args[0].(string)
+			if strings.Contains(s, "call setloclist(0, [], "+action+", ") {
+				return s
+			}
+		}
+		return ""
+	}
+
+	c.Assert(t.plug.Outline(nil), IsNil)
+	want := "[" + strings.Join([]string{
+		item(7, 7, "const C"),
+		item(11, 5, "var V"),
+		item(9, 6, "func F(a int) error"),
+		item(3, 6, "type T struct"),
+		item(5, 13, "  func (t *T) M()"),
+		item(15, 6, "type I interface"),
+		item(13, 12, "func (s S) N()"),
+	}, ", ") + "]"
+	c.Assert(strings.Contains(lastList("' '"), want), Equals, true, Commentf("%v", lastList("' '")))
+	c.Assert(strings.Contains(lastList("' '"), "'title': 'Outline of o.go'"), Equals, true)
+
+	// the outline follows edits
+	t.nvim.setBuffer(fn, "package p\n\nfunc G() {}")
+	t.plug.BufferUpdate(nil)
+	want = "'items': [" + item(3, 6, "func G()") + "]"
+	ok := waitFor(2*time.Second, func() bool {
+		return strings.Contains(lastList("'r'"), want)
+	})
+	c.Assert(ok, Equals, true, Commentf("%v", lastList("'r'")))
+}
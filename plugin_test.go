@@ -0,0 +1,133 @@
+package neogo
+
+import (
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/myitcv/neovim"
+	. "gopkg.in/check.v1"
+)
+
+// PluginTest runs the plugin end to end against fakeNvim, so unlike
+// NeovimGoTest it needs no Neovim binary
+type PluginTest struct {
+	nvim   *fakeNvim
+	client *neovim.Client
+	plug   *Neogo
+}
+
+var _ = Suite(&PluginTest{})
+
+const pluginTestSrc = `package p
+
+import "fmt"
+
+func f() {
+	for i := 0; i < 3; i++ {
+		fmt.Println("hi")
+	}
+}`
+
+func (t *PluginTest) SetUpTest(c *C) {
+	nvim, err := newFakeNvim()
+	c.Assert(err, IsNil)
+	t.nvim = nvim
+
+	// highlight as soon as we are asked to
+	nvim.setVar("neogo_debounce", int64(0))
+	nvim.setBuffer("/tmp/p.go", pluginTestSrc)
+
+	l := log.New(os.Stderr, "", log.LstdFlags)
+	client, err := neovim.NewUnixClient(neovim.NullInitMethod, "unix", nil, &net.UnixAddr{Name: nvim.addr}, l)
+	c.Assert(err, IsNil)
+	t.client = client
+
+	t.plug = &Neogo{}
+	err = t.plug.Init(client, l)
+	c.Assert(err, IsNil)
+}
+
+func (t *PluginTest) TearDownTest(c *C) {
+	c.Check(t.plug.Shutdown(), IsNil)
+	t.client.Close()
+	t.nvim.Close()
+}
+
+// update triggers a BufferUpdate and waits for the matches in the fake to
+// equal want
+func (t *PluginTest) update(c *C, want []Span) {
+	t.plug.BufferUpdate(nil)
+	ok := waitFor(2*time.Second, func() bool {
+		got := t.nvim.spans()
+		if len(got) != len(want) {
+			return false
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				return false
+			}
+		}
+		return true
+	})
+	c.Assert(ok, Equals, true, Commentf("got %v\nwant %v", t.nvim.spans(), want))
+}
+
+func (t *PluginTest) TestHighlight(c *C) {
+	want := highlightString(c, "/tmp/p.go", pluginTestSrc)
+	t.update(c, want)
+
+	adds := len(t.nvim.recorded("vim_eval", "nvim_eval"))
+
+	// change the string; exactly one match should be replaced
+	src := strings.Replace(pluginTestSrc, `"hi"`, `"hello"`, 1)
+	t.nvim.setBuffer("/tmp/p.go", src)
+	t.update(c, highlightString(c, "/tmp/p.go", src))
+
+	var deletes []string
+	for _, e := range t.nvim.recorded("vim_eval", "nvim_eval")[adds:] {
+		if s := e.Args[0].(string); strings.HasPrefix(s, "matchdelete") {
+			deletes = append(deletes, s)
+		}
+	}
+	c.Assert(deletes, HasLen, 1)
+}
+
+func (t *PluginTest) TestViewport(c *C) {
+	t.nvim.mu.Lock()
+	t.nvim.view = fakeView{topline: 1, height: 2, width: 80}
+	t.nvim.mu.Unlock()
+
+	var want []Span
+	for _, s := range highlightString(c, "/tmp/p.go", pluginTestSrc) {
+		if s.Line <= 3 {
+			want = append(want, s)
+		}
+	}
+	t.update(c, want)
+}
+
+func (t *PluginTest) TestReloadConfig(c *C) {
+	t.update(c, highlightString(c, "/tmp/p.go", pluginTestSrc))
+
+	t.nvim.setVar("neogo_features", []interface{}{})
+	c.Assert(t.plug.ReloadConfig(nil), IsNil)
+	c.Assert(t.plug.config().Enabled(FeatureHighlight), Equals, false)
+	t.update(c, nil)
+
+	t.nvim.setVar("neogo_features", []interface{}{FeatureHighlight})
+	t.nvim.setVar("neogo_max_file_size", int64(10))
+	c.Assert(t.plug.ReloadConfig(nil), IsNil)
+	t.update(c, nil)
+
+	t.nvim.setVar("neogo_max_file_size", int64(0))
+	c.Assert(t.plug.ReloadConfig(nil), IsNil)
+	t.update(c, highlightString(c, "/tmp/p.go", pluginTestSrc))
+}
+
+func (t *PluginTest) TestBadConfig(c *C) {
+	t.nvim.setVar("neogo_log_level", "loud")
+	c.Assert(t.plug.ReloadConfig(nil), ErrorMatches, `g:neogo_log_level: .*`)
+}
@@ -0,0 +1,128 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+
+	"github.com/myitcv/neovim"
+)
+
+// References fills the quickfix list with the uses of the object under the
+// cursor in the current package (and its tests). With all, every package in
+// the workspace that imports the object's package is searched too. Exposed
+// as NeogoReferences and :NeogoReferences[!]
+func (n *Neogo) References(o *neovim.MethodOptionParams, all bool) error {
+	return n.report(n.references(all))
+}
+
+func (n *Neogo) references(all bool) error {
+	if err := n.requireFeature(FeatureReferences); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	p, f, err := n.typeCheck(b)
+	if err != nil {
+		return err
+	}
+
+	id, obj := objectAt(p, f, filePos(n.ldr.fset, f, b.offset(b.line, b.col)))
+	if id == nil {
+		return fmt.Errorf("no identifier under cursor")
+	}
+	if obj == nil {
+		return fmt.Errorf("could not resolve %v", id.Name)
+	}
+	if !obj.Pos().IsValid() {
+		return fmt.Errorf("%v is predeclared", obj.Name())
+	}
+
+	pkgs, err := n.searchPackages(p.dir, obj, all)
+	if err != nil {
+		return err
+	}
+	refs := findReferences(n.ldr.fset, pkgs, obj)
+
+	lines := make(map[string][]string)
+	items := make([]qfItem, len(refs))
+	for i, r := range refs {
+		items[i] = qfItem{pos: r, text: n.lineText(lines, r.Filename, r.Line)}
+	}
+	n.echo(fmt.Sprintf("%v references to %v", len(items), obj.Name()))
+	return n.setList(false, "References to "+obj.Name(), items)
+}
+
+// searchPackages returns the packages to search for uses of obj: every
+// variant of the package in dir and, if all is set and obj could be used
+// elsewhere, every variant of every workspace package that imports obj's
+// package
+func (n *Neogo) searchPackages(dir string, obj types.Object, all bool) ([]*pkgInfo, error) {
+	res, err := n.ldr.checkAll(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !all || obj.Pkg() == nil || !obj.Exported() {
+		return res, nil
+	}
+	path := obj.Pkg().Path()
+	for _, d := range workspaceDirs(workspaceRoot(dir)) {
+		if d == dir {
+			continue
+		}
+		bp, err := n.ldr.buildPackage(d)
+		if err != nil || !(contains(bp.Imports, path) || contains(bp.TestImports, path) || contains(bp.XTestImports, path)) {
+			continue
+		}
+		ps, err := n.ldr.checkAll(d)
+		if err != nil {
+			n.debugf("references: skipping %v: %v", d, err)
+			continue
+		}
+		res = append(res, ps...)
+	}
+	return res, nil
+}
+
+// findReferences returns the positions, in file order and without
+// duplicates, of the declaration and uses of obj in pkgs
+func findReferences(fset *token.FileSet, pkgs []*pkgInfo, obj types.Object) []token.Position {
+	seen := make(map[token.Position]bool)
+	var res []token.Position
+	for _, p := range pkgs {
+		for _, m := range []map[*ast.Ident]types.Object{p.info.Defs, p.info.Uses} {
+			for id, o := range m {
+				if o == nil || !sameObject(fset, o, obj) {
+					continue
+				}
+				pos := fset.Position(id.Pos())
+				if !seen[pos] {
+					seen[pos] = true
+					res = append(res, pos)
+				}
+			}
+		}
+	}
+	sort.Sort(positions(res))
+	return res
+}
+
+type positions []token.Position
+
+func (p positions) Len() int      { return len(p) }
+func (p positions) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p positions) Less(i, j int) bool {
+	if p[i].Filename != p[j].Filename {
+		return filepath.ToSlash(p[i].Filename) < filepath.ToSlash(p[j].Filename)
+	}
+	return p[i].Offset < p[j].Offset
+}
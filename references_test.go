@@ -0,0 +1,57 @@
+package neogo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (t *PluginTest) TestReferences(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go":      "package a\n\nimport \"example.com/p/b\"\n\nvar x = b.B()\n",
+		"b/b.go":      "package b\n\nfunc B() int { return 1 }\n\nvar y = B()\n",
+		"b/b_test.go": "package b\n\nvar z = B() + y\n",
+		"c/c.go":      "package c\n\nfunc B() {}\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+
+	afn := filepath.Join(root, "a", "a.go")
+	bfn := filepath.Join(root, "b", "b.go")
+	btfn := filepath.Join(root, "b", "b_test.go")
+
+	item := func(fn string, line, col int, text string) string {
+		return vimValue(map[string]interface{}{"filename": fn, "lnum": line, "col": col, "text": text})
+	}
+	lastList := func() string {
+		cmds := t.nvim.recorded("vim_command", "nvim_command")
+		for i := len(cmds) - 1; i >= 0; i-- {
+			if s := cmds[i].Args[0].(string); strings.HasPrefix(s, "call setqflist(") {
+				return s
+			}
+		}
+		return ""
+	}
+
+	t.nvim.setBuffer(bfn, "package b\n\nfunc B() int { return 1 }\n\nvar y = B()")
+	t.nvim.setCursor(3, "B", 0)
+
+	c.Assert(t.plug.References(nil, false), IsNil)
+	want := "[" + strings.Join([]string{
+		item(bfn, 3, 6, "func B() int { return 1 }"),
+		item(bfn, 5, 9, "var y = B()"),
+		item(btfn, 3, 9, "var z = B() + y"),
+	}, ", ") + "]"
+	c.Assert(strings.Contains(lastList(), want), Equals, true, Commentf("%v", lastList()))
+
+	c.Assert(t.plug.References(nil, true), IsNil)
+	want = "[" + strings.Join([]string{
+		item(afn, 5, 11, "var x = b.B()"),
+		item(bfn, 3, 6, "func B() int { return 1 }"),
+		item(bfn, 5, 9, "var y = B()"),
+		item(btfn, 3, 9, "var z = B() + y"),
+	}, ", ") + "]"
+	c.Assert(strings.Contains(lastList(), want), Equals, true, Commentf("%v", lastList()))
+}
@@ -0,0 +1,409 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/myitcv/neovim"
+)
+
+// Rename renames the object under the cursor to newName, throughout its
+// package and, if it is exported, the packages of the workspace that import
+// it. The renamed packages are type-checked before anything is changed; a
+// rename that would introduce errors, or make a name refer to a different
+// object (a conflict, or shadowing), is refused. The changes are previewed
+// in the quickfix list and, once confirmed, made to open buffers, which are
+// left modified, and to the other files on disk, all of which are written
+// before any replaces its original. Exposed as NeogoRename and
+// :NeogoRename {newname}
+func (n *Neogo) Rename(o *neovim.MethodOptionParams, newName string) error {
+	return n.report(n.rename(newName))
+}
+
+func (n *Neogo) rename(newName string) error {
+	if err := n.requireFeature(FeatureRename); err != nil {
+		return err
+	}
+	if !token.IsIdentifier(newName) || newName == "_" {
+		return fmt.Errorf("%q is not a valid name", newName)
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+
+	// the loader must see the other open buffers as they are, not as saved;
+	// the overlays added for that go again when done, but for those of the
+	// buffers renamed in, which are left modified
+	bufs, err := n.openBuffers()
+	if err != nil {
+		return err
+	}
+	added := make(map[string]bool)
+	kept := make(map[string]bool)
+	defer func() {
+		for fn := range added {
+			if !kept[fn] {
+				n.ldr.clearOverlay(fn)
+			}
+		}
+	}()
+	for fn, nr := range bufs {
+		if fn == b.name {
+			continue
+		}
+		lines, err := n.bufLines(nr)
+		if err != nil {
+			return err
+		}
+		if !n.ldr.hasOverlay(fn) {
+			added[fn] = true
+		}
+		n.ldr.setOverlay(fn, []byte(strings.Join(lines, "\n")+"\n"))
+	}
+
+	p, f, err := n.typeCheck(b)
+	if err != nil {
+		return err
+	}
+	id, obj := objectAt(p, f, filePos(n.ldr.fset, f, b.offset(b.line, b.col)))
+	if id == nil {
+		return fmt.Errorf("no identifier under cursor")
+	}
+	if obj == nil {
+		return fmt.Errorf("could not resolve %v", id.Name)
+	}
+	obj = origin(obj)
+	oldName := obj.Name()
+	switch {
+	case !obj.Pos().IsValid():
+		return fmt.Errorf("%v is predeclared", oldName)
+	case oldName == newName:
+		return fmt.Errorf("%v is already called that", oldName)
+	}
+	if _, ok := obj.(*types.PkgName); ok {
+		return fmt.Errorf("cannot rename the import of %v", oldName)
+	}
+	root := workspaceRoot(p.dir)
+	if decl := n.ldr.fset.Position(obj.Pos()).Filename; !strings.HasPrefix(decl, root+string(filepath.Separator)) {
+		return fmt.Errorf("%v is declared outside the workspace, in %v", oldName, decl)
+	}
+
+	pkgs, err := n.searchPackages(p.dir, obj, true)
+	if err != nil {
+		return err
+	}
+	refs := findReferences(n.ldr.fset, pkgs, obj)
+
+	r := &renaming{fset: n.ldr.fset, obj: obj, oldName: oldName, newName: newName, offsets: make(map[string][]int)}
+	for _, ref := range refs {
+		r.offsets[ref.Filename] = append(r.offsets[ref.Filename], ref.Offset)
+	}
+	old := make(map[string][]byte)
+	renamed := make(map[string][]byte)
+	for fn, offs := range r.offsets {
+		src, err := n.ldr.source(fn)
+		if err != nil {
+			return err
+		}
+		res, err := r.apply(src, offs)
+		if err != nil {
+			return fmt.Errorf("%v: %v", fn, err)
+		}
+		old[fn], renamed[fn] = src, res
+	}
+
+	// try it
+	restore := func() {
+		for fn := range renamed {
+			if _, ok := bufs[fn]; ok {
+				n.ldr.setOverlay(fn, old[fn])
+			} else {
+				n.ldr.clearOverlay(fn)
+			}
+		}
+	}
+	for fn, src := range renamed {
+		n.ldr.setOverlay(fn, src)
+	}
+	var after []*pkgInfo
+	dirs := make(map[string]bool)
+	for _, p := range pkgs {
+		if dirs[p.dir] {
+			continue
+		}
+		dirs[p.dir] = true
+		ps, err := n.ldr.checkAll(p.dir)
+		if err != nil {
+			restore()
+			return err
+		}
+		after = append(after, ps...)
+	}
+	if err := r.conflict(pkgs, after); err != nil {
+		restore()
+		return err
+	}
+
+	// preview
+	var files []string
+	for fn := range renamed {
+		files = append(files, fn)
+	}
+	sort.Strings(files)
+	items := make([]qfItem, len(refs))
+	for i, ref := range refs {
+		lines := bytes.Split(renamed[ref.Filename], []byte("\n"))
+		items[i] = qfItem{pos: ref, text: strings.TrimSpace(string(lines[ref.Line-1]))}
+	}
+	if err := n.setList(false, "Rename "+oldName+" to "+newName, items); err != nil {
+		restore()
+		return err
+	}
+	ok, err := n.confirm(fmt.Sprintf("Rename %v to %v: %v changes in %v files?", oldName, newName, len(refs), len(files)))
+	if err != nil || !ok {
+		restore()
+		if err == nil {
+			n.echo("rename cancelled")
+		}
+		return err
+	}
+
+	// disk first, so that a failure leaves everything as it was
+	disk := make(map[string][]byte)
+	for _, fn := range files {
+		if _, ok := bufs[fn]; !ok {
+			disk[fn] = renamed[fn]
+		}
+	}
+	if err := writeFiles(disk); err != nil {
+		restore()
+		return err
+	}
+	for fn := range disk {
+		n.ldr.clearOverlay(fn)
+	}
+	for _, fn := range files {
+		nr, ok := bufs[fn]
+		if !ok {
+			continue
+		}
+		edits := lineDiff(srcLines(old[fn]), srcLines(renamed[fn]))
+		if fn == b.name {
+			err = n.applyEdits(edits)
+		} else {
+			err = n.editBuffer(nr, edits)
+		}
+		if err != nil {
+			return err
+		}
+		kept[fn] = true
+	}
+	n.echo(fmt.Sprintf("renamed %v to %v: %v changes in %v files", oldName, newName, len(refs), len(files)))
+	return nil
+}
+
+// renaming is a rename of obj from oldName to newName at offsets, the byte
+// offsets of its declaration and uses by file
+type renaming struct {
+	fset             *token.FileSet
+	obj              types.Object
+	oldName, newName string
+	offsets          map[string][]int
+}
+
+// apply returns src with the identifiers at offs, sorted, renamed
+func (r *renaming) apply(src []byte, offs []int) ([]byte, error) {
+	var buf bytes.Buffer
+	last := 0
+	for _, off := range offs {
+		if off+len(r.oldName) > len(src) || string(src[off:off+len(r.oldName)]) != r.oldName {
+			return nil, fmt.Errorf("%v not found at offset %v", r.oldName, off)
+		}
+		buf.Write(src[last:off])
+		buf.WriteString(r.newName)
+		last = off + len(r.oldName)
+	}
+	buf.Write(src[last:])
+	return buf.Bytes(), nil
+}
+
+// moved returns where p, a position before the rename, is after it
+func (r *renaming) moved(p token.Position) token.Position {
+	for _, off := range r.offsets[p.Filename] {
+		if off < p.Offset {
+			p.Offset += len(r.newName) - len(r.oldName)
+		}
+	}
+	p.Line, p.Column = 0, 0
+	return p
+}
+
+// conflict compares before and after, the renamed packages checked before
+// and after the rename. It fails if the rename adds errors, or if any
+// identifier now called newName denotes other than what it did
+func (r *renaming) conflict(before, after []*pkgInfo) error {
+	var errs []string
+	for _, p := range before {
+		for _, err := range p.errs {
+			errs = append(errs, errorMsg(err))
+		}
+	}
+
+	// what each identifier called newName afterwards should denote
+	want := make(map[token.Position]objKey)
+	for _, p := range before {
+		for _, m := range []map[*ast.Ident]types.Object{p.info.Defs, p.info.Uses} {
+			for id, obj := range m {
+				if obj == nil || !obj.Pos().IsValid() || isEmbedded(obj) {
+					continue
+				}
+				k := keyOf(r.fset, obj)
+				switch {
+				case sameObject(r.fset, obj, r.obj):
+					k.name = r.newName
+				case id.Name != r.newName:
+					continue
+				}
+				k.pos = r.moved(k.pos)
+				want[r.moved(r.fset.Position(id.Pos()))] = k
+			}
+		}
+	}
+
+	for _, p := range after {
+		for _, err := range p.errs {
+			msg := strings.Replace(errorMsg(err), r.newName, r.oldName, -1)
+			if !contains(errs, msg) {
+				return fmt.Errorf("renaming %v to %v would cause an error: %v", r.oldName, r.newName, err)
+			}
+		}
+		for _, m := range []map[*ast.Ident]types.Object{p.info.Defs, p.info.Uses} {
+			for id, obj := range m {
+				if id.Name != r.newName || obj == nil || isEmbedded(obj) {
+					continue
+				}
+				pos := r.fset.Position(id.Pos())
+				k, ok := want[token.Position{Filename: pos.Filename, Offset: pos.Offset}]
+				if !ok {
+					continue
+				}
+				if !obj.Pos().IsValid() || keyOf(r.fset, obj) != k {
+					return fmt.Errorf("renaming %v to %v would change the meaning of %v at %v:%v", r.oldName, r.newName, r.newName, filepath.Base(pos.Filename), pos.Line)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isEmbedded reports whether obj is an embedded field, which is defined by
+// the same identifier that uses its type
+func isEmbedded(obj types.Object) bool {
+	v, ok := obj.(*types.Var)
+	return ok && v.Embedded()
+}
+
+// errorMsg returns the message of err without its position
+func errorMsg(err error) string {
+	if te, ok := err.(types.Error); ok {
+		return te.Msg
+	}
+	return err.Error()
+}
+
+// srcLines splits src into lines as Neovim holds them
+func srcLines(src []byte) []string {
+	return strings.Split(strings.TrimSuffix(string(src), "\n"), "\n")
+}
+
+// writeFiles writes the files, each to a temporary file alongside it first.
+// Only once all are written are they renamed over the originals. Should a
+// rename fail, the files already renamed are put back as they were, from
+// copies of the originals read beforehand, and those that did not exist are
+// removed
+func writeFiles(files map[string][]byte) error {
+	tmps := make(map[string]string)
+	cleanup := func() {
+		for _, tmp := range tmps {
+			os.Remove(tmp)
+		}
+	}
+	// the originals and their modes; files that did not exist have no
+	// original
+	origs := make(map[string][]byte)
+	modes := make(map[string]os.FileMode)
+	for fn, src := range files {
+		modes[fn] = 0644
+		if fi, err := os.Stat(fn); err == nil {
+			modes[fn] = fi.Mode()
+			if origs[fn], err = ioutil.ReadFile(fn); err != nil {
+				cleanup()
+				return err
+			}
+		}
+		tmp, err := writeTemp(fn, src, modes[fn])
+		if err != nil {
+			cleanup()
+			return err
+		}
+		tmps[fn] = tmp
+	}
+	var done []string
+	for fn, tmp := range tmps {
+		if err := renameFile(tmp, fn); err != nil {
+			cleanup()
+			for _, fn := range done {
+				if orig, ok := origs[fn]; ok {
+					if tmp, terr := writeTemp(fn, orig, modes[fn]); terr == nil {
+						if os.Rename(tmp, fn) != nil {
+							os.Remove(tmp)
+						}
+					}
+				} else {
+					os.Remove(fn)
+				}
+			}
+			return err
+		}
+		delete(tmps, fn)
+		done = append(done, fn)
+	}
+	return nil
+}
+
+// renameFile renames a file; a variable so that tests can make it fail
+var renameFile = os.Rename
+
+// writeTemp writes src with mode to a new temporary file alongside fn,
+// returning its name
+func writeTemp(fn string, src []byte, mode os.FileMode) (string, error) {
+	tf, err := ioutil.TempFile(filepath.Dir(fn), "."+filepath.Base(fn)+".neogo")
+	if err != nil {
+		return "", err
+	}
+	_, err = tf.Write(src)
+	if cerr := tf.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tf.Name(), mode)
+	}
+	if err != nil {
+		os.Remove(tf.Name())
+		return "", err
+	}
+	return tf.Name(), nil
+}
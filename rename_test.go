@@ -0,0 +1,158 @@
+package neogo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+const renameTestSrc = `package a
+
+type T struct{ N int }
+
+func New() T { return T{N: 1} }
+
+func F() int {
+	x := 1
+	y := 2
+	if y > 0 {
+		z := 3
+		return x + z
+	}
+	return x + y
+}`
+
+func (t *PluginTest) TestRename(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go":  renameTestSrc + "\n",
+		"a/a2.go": "package a\n\nvar v = New()\n",
+		"b/b.go":  "package b\n\nimport \"example.com/p/a\"\n\nvar V = a.New()\n",
+		"c/c.go":  "package c\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+	afn := filepath.Join(root, "a", "a.go")
+	a2fn := filepath.Join(root, "a", "a2.go")
+	bfn := filepath.Join(root, "b", "b.go")
+
+	answer := int64(1)
+	t.nvim.handleEval(`^confirm\(`, func(m []string) (interface{}, error) {
+		return answer, nil
+	})
+	t.nvim.setBuffer(afn, renameTestSrc)
+	// b.go is open, with changes not yet saved
+	bsrc := "package b\n\nimport \"example.com/p/a\"\n\nvar V = a.New()\nvar W = a.New()"
+	bh := t.nvim.addBuffer(bfn, bsrc)
+	// as is c.go, which no rename touches
+	cfn := filepath.Join(root, "c", "c.go")
+	t.nvim.addBuffer(cfn, "package c\n\nvar X = 1")
+	disk := func(fn string) string {
+		src, err := ioutil.ReadFile(fn)
+		c.Assert(err, IsNil)
+		return string(src)
+	}
+	// the loader sees fn as saved
+	saved := func(fn string) {
+		src, err := t.plug.ldr.source(fn)
+		c.Assert(err, IsNil)
+		c.Assert(string(src), Equals, disk(fn))
+	}
+	rename := func(line int, marker, newName string) error {
+		t.nvim.setCursor(line, marker, 0)
+		return t.plug.Rename(nil, newName)
+	}
+
+	// conflicts with T
+	c.Assert(rename(5, "New", "T"), ErrorMatches, "renaming New to T would cause an error: .*")
+	// z would be x, hiding the outer x
+	c.Assert(rename(11, "z", "x"), ErrorMatches, "renaming z to x would change the meaning of x at a.go:12")
+	// b uses it
+	c.Assert(rename(5, "New", "newT"), ErrorMatches, "renaming New to newT would cause an error: .*")
+	c.Assert(rename(5, "New", "1x"), ErrorMatches, `"1x" is not a valid name`)
+	c.Assert(rename(3, "int", "Int"), ErrorMatches, "int is predeclared")
+	// no overlay is left behind for the other buffers
+	saved(bfn)
+	saved(cfn)
+
+	answer = 2
+	c.Assert(rename(5, "New", "Make"), IsNil)
+	c.Assert(strings.Join(t.nvim.bufferLines(), "\n"), Equals, renameTestSrc)
+	c.Assert(disk(a2fn), Equals, "package a\n\nvar v = New()\n")
+	saved(bfn)
+	saved(cfn)
+
+	answer = 1
+	c.Assert(rename(5, "New", "Make"), IsNil)
+	c.Assert(strings.Join(t.nvim.bufferLines(), "\n"), Equals, strings.Replace(renameTestSrc, "New", "Make", 1))
+	c.Assert(disk(a2fn), Equals, "package a\n\nvar v = Make()\n")
+	c.Assert(strings.Join(t.nvim.linesOf(bh), "\n"), Equals, strings.Replace(bsrc, "New", "Make", -1))
+	c.Assert(disk(bfn), Equals, "package b\n\nimport \"example.com/p/a\"\n\nvar V = a.New()\n")
+	// but for that of b.go, which is left modified
+	src, err := t.plug.ldr.source(bfn)
+	c.Assert(err, IsNil)
+	c.Assert(string(src), Equals, strings.Replace(bsrc, "New", "Make", -1)+"\n")
+	saved(cfn)
+
+	// the preview
+	var list string
+	cmds := t.nvim.recorded("vim_command", "nvim_command")
+	for i := len(cmds) - 1; i >= 0 && list == ""; i-- {
+		if s := cmds[i].Args[0].(string); strings.HasPrefix(s, "call setqflist(") {
+			list = s
+		}
+	}
+	c.Assert(list, Matches, `.*'title': 'Rename New to Make'.*`)
+	for _, text := range []string{"func Make() T { return T{N: 1} }", "var v = Make()", "var V = a.Make()", "var W = a.Make()"} {
+		c.Assert(strings.Contains(list, vimValue(text)), Equals, true, Commentf("%v", text))
+	}
+
+	// a local, which is no one else's business
+	c.Assert(rename(11, "z", "w"), IsNil)
+	c.Assert(t.nvim.bufferLines()[10:12], DeepEquals, []string{"\t\tw := 3", "\t\treturn x + w"})
+}
+
+func (t *PluginTest) TestWriteFiles(c *C) {
+	dir, err := ioutil.TempDir("", "neogo-test")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+	a, b, n := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go"), filepath.Join(dir, "n.go")
+	c.Assert(ioutil.WriteFile(a, []byte("a"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(b, []byte("b"), 0600), IsNil)
+
+	// whichever file fails to be renamed into place, everything is left as
+	// it was
+	defer func() { renameFile = os.Rename }()
+	for _, fail := range []string{a, b, n} {
+		renameFile = func(from, to string) error {
+			if to == fail {
+				return fmt.Errorf("cannot rename %v", to)
+			}
+			return os.Rename(from, to)
+		}
+		err := writeFiles(map[string][]byte{a: []byte("A"), b: []byte("B"), n: []byte("N")})
+		c.Assert(err, ErrorMatches, "cannot rename .*")
+		src, _ := ioutil.ReadFile(a)
+		c.Assert(string(src), Equals, "a")
+		src, _ = ioutil.ReadFile(b)
+		c.Assert(string(src), Equals, "b")
+		fi, err := os.Stat(b)
+		c.Assert(err, IsNil)
+		c.Assert(fi.Mode().Perm(), Equals, os.FileMode(0600))
+		names, err := filepath.Glob(filepath.Join(dir, "*"))
+		c.Assert(err, IsNil)
+		c.Assert(names, DeepEquals, []string{a, b})
+		names, _ = filepath.Glob(filepath.Join(dir, ".*"))
+		c.Assert(names, HasLen, 0)
+	}
+
+	renameFile = os.Rename
+	c.Assert(writeFiles(map[string][]byte{a: []byte("A"), n: []byte("N")}), IsNil)
+	src, _ := ioutil.ReadFile(a)
+	c.Assert(string(src), Equals, "A")
+	src, _ = ioutil.ReadFile(n)
+	c.Assert(string(src), Equals, "N")
+}
@@ -0,0 +1,172 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+	"time"
+
+	"github.com/myitcv/neovim"
+)
+
+// signatureHighlight is the highlight group of the current parameter
+const signatureHighlight = "Search"
+
+// SignatureHelp shows, while the cursor is within the parentheses of a
+// call, the signature of the function called in a floating window above
+// the cursor, with the parameter of the argument being typed highlighted.
+// Requests are debounced like BufferUpdate. Exposed as NeogoSignatureHelp,
+// called on TextChangedI and CursorMovedI
+func (n *Neogo) SignatureHelp(o *neovim.MethodOptionParams) error {
+	select {
+	case n.sig <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (n *Neogo) signatureLoop(ch, done chan struct{}) {
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ch:
+			debounce = time.After(n.config().Debounce)
+		case <-debounce:
+			debounce = nil
+			if err := n.signatureHelp(); err != nil {
+				n.debugf("signature help: %v", err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func (n *Neogo) signatureHelp() error {
+	if !n.config().Enabled(FeatureSignature) {
+		return nil
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+	p, f, err := n.typeCheck(b)
+	if err != nil {
+		n.closeFloat()
+		return err
+	}
+	src := b.src()
+	pos := filePos(n.ldr.fset, f, b.offset(b.line, b.col))
+
+	call := callAt(f, pos)
+	if call == nil {
+		return n.closeFloat()
+	}
+	tv, ok := p.info.Types[call.Fun]
+	if !ok || tv.IsType() {
+		return n.closeFloat()
+	}
+	sig, ok := tv.Type.Underlying().(*types.Signature)
+	if !ok {
+		return n.closeFloat()
+	}
+
+	tf := n.ldr.fset.File(f.Pos())
+	label, params := signatureLabel(calleeName(call), sig, types.RelativeTo(p.pkg))
+	o := floatOptions{filetype: "go", above: true, closeOn: "InsertLeave,BufLeave"}
+	i := argIndex(tf, src, call, pos)
+	if sig.Variadic() && i >= len(params) {
+		i = len(params) - 1
+	}
+	if i < len(params) {
+		p := params[i]
+		o.highlights = []Span{{Line: 1, Col: p[0] + 1, Len: p[1] - p[0], Class: signatureHighlight}}
+	}
+	return n.float([]string{label}, o)
+}
+
+// callAt returns the innermost call whose parentheses contain pos, or nil.
+// Function literals and blocks stop the search: within them we are no
+// longer typing an argument
+func callAt(f *ast.File, pos token.Pos) *ast.CallExpr {
+	for _, nd := range enclosing(f, pos) {
+		switch nd := nd.(type) {
+		case *ast.CallExpr:
+			if nd.Lparen < pos && pos <= nd.Rparen {
+				return nd
+			}
+		case *ast.FuncLit, *ast.BlockStmt:
+			return nil
+		}
+	}
+	return nil
+}
+
+// calleeName returns the name of the function called, as written
+func calleeName(call *ast.CallExpr) string {
+	switch f := ast.Unparen(call.Fun).(type) {
+	case *ast.Ident:
+		return f.Name
+	case *ast.SelectorExpr:
+		return f.Sel.Name
+	}
+	return "func"
+}
+
+// argIndex returns the index of the argument of call being typed at pos:
+// the number of arguments followed by a comma before pos
+func argIndex(tf *token.File, src []byte, call *ast.CallExpr, pos token.Pos) int {
+	i := 0
+	for _, a := range call.Args {
+		end := a.End()
+		if end >= pos || !end.IsValid() {
+			break
+		}
+		between := src[tf.Offset(end):tf.Offset(pos)]
+		if bytes.IndexByte(between, ',') == -1 {
+			break
+		}
+		i++
+	}
+	return i
+}
+
+// signatureLabel formats sig as the declaration of a function called name,
+// returning the byte ranges of the parameters within it
+func signatureLabel(name string, sig *types.Signature, qual types.Qualifier) (string, [][2]int) {
+	var buf strings.Builder
+	buf.WriteString(name + "(")
+	var params [][2]int
+	for i := 0; i < sig.Params().Len(); i++ {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		start := buf.Len()
+		v := sig.Params().At(i)
+		if v.Name() != "" {
+			buf.WriteString(v.Name() + " ")
+		}
+		if s, ok := v.Type().(*types.Slice); ok && sig.Variadic() && i == sig.Params().Len()-1 {
+			buf.WriteString("..." + types.TypeString(s.Elem(), qual))
+		} else {
+			buf.WriteString(types.TypeString(v.Type(), qual))
+		}
+		params = append(params, [2]int{start, buf.Len()})
+	}
+	buf.WriteString(")")
+
+	res := sig.Results()
+	switch {
+	case res.Len() == 1 && res.At(0).Name() == "":
+		buf.WriteString(" " + types.TypeString(res.At(0).Type(), qual))
+	case res.Len() > 0:
+		buf.WriteString(" " + types.TypeString(res, qual))
+	}
+	return buf.String(), params
+}
@@ -0,0 +1,61 @@
+package neogo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (t *PluginTest) TestSignatureHelp(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": "package a\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+	afn := filepath.Join(root, "a", "a.go")
+
+	lastFloat := func() string {
+		cmds := t.nvim.recorded("vim_command", "nvim_command")
+		if len(cmds) == 0 {
+			return ""
+		}
+		return cmds[len(cmds)-1].Args[0].(string)
+	}
+	check := func(src string, line int, marker string, delta int, want string) {
+		n := len(t.nvim.recorded("vim_command", "nvim_command"))
+		t.nvim.setBuffer(afn, src)
+		t.nvim.setCursor(line, marker, delta)
+		c.Assert(t.plug.SignatureHelp(nil), IsNil)
+		ok := waitFor(2*time.Second, func() bool {
+			return len(t.nvim.recorded("vim_command", "nvim_command")) > n
+		})
+		c.Assert(ok, Equals, true)
+		c.Check(strings.Contains(lastFloat(), want), Equals, true, Commentf("%v", lastFloat()))
+	}
+
+	const decl = "package a\n\nfunc F(a int, b ...string) error { return nil }\n\n"
+
+	check(decl+"func g() {\n\tF(1, \"x\")\n}", 6, "1", 0,
+		`['F(a int, b ...string) error'])`+` | call nvim_buf_set_option(w:neogo_float_buf, 'filetype', 'go')`+
+			` | call nvim_buf_add_highlight(w:neogo_float_buf, -1, 'Search', 0, 2, 7)`)
+	check(decl+"func g() {\n\tF(1, \"x\")\n}", 6, "\"x\"", 0,
+		"call nvim_buf_add_highlight(w:neogo_float_buf, -1, 'Search', 0, 9, 20)")
+
+	// each float's buffer goes with its window, and its autocmd replaces the
+	// last one's
+	c.Check(strings.Contains(lastFloat(), "call nvim_buf_set_option(w:neogo_float_buf, 'bufhidden', 'wipe')"), Equals, true)
+	c.Check(strings.Contains(lastFloat(), "execute 'autocmd! neogo_float * <buffer>' | execute 'autocmd neogo_float "), Equals, true)
+	check(decl+"func g() {\n\tF(1, \"x\", \"y\")\n}", 6, "\"y\"", 0,
+		"call nvim_buf_add_highlight(w:neogo_float_buf, -1, 'Search', 0, 9, 20)")
+
+	// an incomplete call
+	check(decl+"func g() {\n\tF(1, \n}", 6, ", ", 2,
+		"call nvim_buf_add_highlight(w:neogo_float_buf, -1, 'Search', 0, 9, 20)")
+
+	// outside a call
+	check(decl+"func g() {\n\tF(1, \"x\")\n}", 6, "F", 0,
+		"if exists('w:neogo_float') | silent! call nvim_win_close(w:neogo_float, v:true) | unlet w:neogo_float | endif")
+}
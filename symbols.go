@@ -0,0 +1,387 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/myitcv/neovim"
+)
+
+// maxSymbols bounds the number of matches NeogoSymbols lists
+const maxSymbols = 200
+
+// Symbols fills the quickfix list with the declarations in the current
+// workspace whose names fuzzy-match query, best matches first. A query may
+// be qualified, e.g. pkg.Type.Meth, in which case the qualifiers must be
+// prefixes of the package and type names. Exposed as NeogoSymbols and :NeogoSymbols {query}
+func (n *Neogo) Symbols(o *neovim.MethodOptionParams, query string) error {
+	return n.report(n.symbols(query))
+}
+
+// BufferWrite is called when filename has been written. The file's contents
+// on disk are now current, so any overlay is dropped, and the symbol index
+// is updated. Exposed as BufferWrite, called on BufWritePost
+func (n *Neogo) BufferWrite(o *neovim.MethodOptionParams, filename string) error {
+	if filename == "" || !strings.HasSuffix(filename, ".go") {
+		return nil
+	}
+	n.ldr.clearOverlay(filename)
+
+	if !n.config().Enabled(FeatureSymbols) {
+		return nil
+	}
+	n.mu.Lock()
+	var idxs []*symbolIndex
+	for root, idx := range n.indexes {
+		if strings.HasPrefix(filename, root+string(filepath.Separator)) {
+			idxs = append(idxs, idx)
+		}
+	}
+	n.mu.Unlock()
+	for _, idx := range idxs {
+		idx.update(filename)
+	}
+	return nil
+}
+
+// BufferEnter is called when a buffer of filename is entered. The symbol
+// index of its workspace starts being built in the background, so that the
+// first :NeogoSymbols need not wait for the workspace to be walked. Exposed
+// as BufferEnter, called on BufEnter
+func (n *Neogo) BufferEnter(o *neovim.MethodOptionParams, filename string) error {
+	if filename == "" || !strings.HasSuffix(filename, ".go") || !n.config().Enabled(FeatureSymbols) {
+		return nil
+	}
+	n.symbolIndex(workspaceRoot(filepath.Dir(filename)))
+	return nil
+}
+
+func (n *Neogo) symbols(query string) error {
+	if err := n.requireFeature(FeatureSymbols); err != nil {
+		return err
+	}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return fmt.Errorf("no query given")
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+
+	idx := n.symbolIndex(workspaceRoot(filepath.Dir(b.name)))
+	<-idx.ready
+	matches := idx.search(query)
+
+	title := "Symbols matching " + query
+	if len(matches) > maxSymbols {
+		title += fmt.Sprintf(" (first %v of %v)", maxSymbols, len(matches))
+		matches = matches[:maxSymbols]
+	}
+	items := make([]qfItem, len(matches))
+	for i, s := range matches {
+		items[i] = qfItem{pos: s.pos, text: s.String()}
+	}
+	n.echo(fmt.Sprintf("%v: %v", title, len(items)))
+	return n.setList(false, title, items)
+}
+
+// symbolIndex returns the index of the workspace rooted at root, starting
+// to build it in the background if this is the first time it is asked for
+func (n *Neogo) symbolIndex(root string) *symbolIndex {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if idx, ok := n.indexes[root]; ok {
+		return idx
+	}
+	if n.indexes == nil {
+		n.indexes = make(map[string]*symbolIndex)
+	}
+	idx := newSymbolIndex(root)
+	n.indexes[root] = idx
+	go func() {
+		idx.build()
+		n.debugf("indexed %v: %v files", root, idx.len())
+	}()
+	return idx
+}
+
+// symbol is a declaration found by the symbol index
+type symbol struct {
+	name string
+	kind string
+	pkg  string
+
+	// recv is the type a method or field belongs to, if any
+	recv string
+
+	pos token.Position
+}
+
+// qualified returns the name of s qualified by its package and type
+func (s symbol) qualified() string {
+	return strings.Join(s.path(), ".")
+}
+
+func (s symbol) path() []string {
+	if s.recv != "" {
+		return []string{s.pkg, s.recv, s.name}
+	}
+	return []string{s.pkg, s.name}
+}
+
+// match reports whether s matches the query split at its dots, and if so
+// how well. The last element is fuzzy-matched against the name of s, those
+// before it must be prefixes (ignoring case) of the qualifiers immediately
+// preceding the name
+func (s symbol) match(query []string) (int, bool) {
+	p := s.path()
+	if len(query) > len(p) {
+		return 0, false
+	}
+	p = p[len(p)-len(query):]
+	for i, q := range query[:len(query)-1] {
+		if len(q) > len(p[i]) || !strings.EqualFold(q, p[i][:len(q)]) {
+			return 0, false
+		}
+	}
+	return fuzzyMatch(query[len(query)-1], s.name)
+}
+
+func (s symbol) String() string {
+	return s.kind + " " + s.qualified()
+}
+
+// symbolIndex holds the declarations of every Go file in a workspace, parsed
+// but not type-checked so that building it is cheap
+type symbolIndex struct {
+	root string
+
+	// ready is closed once the initial build is done
+	ready chan struct{}
+
+	mu sync.Mutex
+
+	// files maps a filename to its symbols. The entry of a file updated (or
+	// removed) while the build is running is newer than anything the build
+	// read, so the build never overwrites an entry
+	files map[string][]symbol
+}
+
+func newSymbolIndex(root string) *symbolIndex {
+	return &symbolIndex{
+		root:  root,
+		ready: make(chan struct{}),
+		files: make(map[string][]symbol),
+	}
+}
+
+func (x *symbolIndex) build() {
+	defer close(x.ready)
+	for _, dir := range workspaceDirs(x.root) {
+		fns, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+		for _, fn := range fns {
+			src, err := ioutil.ReadFile(fn)
+			if err != nil {
+				continue
+			}
+			syms := fileSymbols(fn, src)
+			x.mu.Lock()
+			if _, ok := x.files[fn]; !ok {
+				x.files[fn] = syms
+			}
+			x.mu.Unlock()
+		}
+	}
+}
+
+// update reindexes filename, which has changed on disk
+func (x *symbolIndex) update(filename string) {
+	src, err := ioutil.ReadFile(filename)
+	var syms []symbol
+	if err == nil {
+		syms = fileSymbols(filename, src)
+	} else if !os.IsNotExist(err) {
+		return
+	}
+	x.mu.Lock()
+	x.files[filename] = syms
+	x.mu.Unlock()
+}
+
+func (x *symbolIndex) len() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return len(x.files)
+}
+
+// search returns the symbols that fuzzy-match query, best first
+func (x *symbolIndex) search(query string) []symbol {
+	parts := strings.Split(query, ".")
+	var res symbolMatches
+	x.mu.Lock()
+	for _, syms := range x.files {
+		for _, s := range syms {
+			if score, ok := s.match(parts); ok {
+				res = append(res, symbolMatch{symbol: s, score: score})
+			}
+		}
+	}
+	x.mu.Unlock()
+
+	sort.Sort(res)
+	syms := make([]symbol, len(res))
+	for i, m := range res {
+		syms[i] = m.symbol
+	}
+	return syms
+}
+
+type symbolMatch struct {
+	symbol
+	score int
+}
+
+type symbolMatches []symbolMatch
+
+func (s symbolMatches) Len() int      { return len(s) }
+func (s symbolMatches) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s symbolMatches) Less(i, j int) bool {
+	a, b := s[i], s[j]
+	switch {
+	case a.score != b.score:
+		return a.score > b.score
+	case len(a.name) != len(b.name):
+		return len(a.name) < len(b.name)
+	case a.qualified() != b.qualified():
+		return a.qualified() < b.qualified()
+	case a.pos.Filename != b.pos.Filename:
+		return a.pos.Filename < b.pos.Filename
+	}
+	return a.pos.Offset < b.pos.Offset
+}
+
+// fileSymbols parses src and returns its package-level declarations, the
+// methods declared on its types and the fields and methods of its struct
+// and interface types
+func fileSymbols(filename string, src []byte) []symbol {
+	fset := token.NewFileSet()
+	f, _ := parser.ParseFile(fset, filename, src, parser.SkipObjectResolution)
+	if f == nil {
+		return nil
+	}
+	pkg := f.Name.Name
+
+	var res []symbol
+	add := func(id *ast.Ident, kind, recv string) {
+		if id == nil || id.Name == "_" {
+			return
+		}
+		res = append(res, symbol{name: id.Name, kind: kind, pkg: pkg, recv: recv, pos: fset.Position(id.Pos())})
+	}
+
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				add(d.Name, "method", recvTypeName(d.Recv.List[0].Type))
+			} else {
+				add(d.Name, "func", "")
+			}
+		case *ast.GenDecl:
+			for _, s := range d.Specs {
+				switch s := s.(type) {
+				case *ast.ValueSpec:
+					for _, id := range s.Names {
+						add(id, d.Tok.String(), "")
+					}
+				case *ast.TypeSpec:
+					add(s.Name, "type", "")
+					switch t := s.Type.(type) {
+					case *ast.StructType:
+						for _, fld := range t.Fields.List {
+							for _, id := range fld.Names {
+								add(id, "field", s.Name.Name)
+							}
+						}
+					case *ast.InterfaceType:
+						for _, m := range t.Methods.List {
+							for _, id := range m.Names {
+								add(id, "method", s.Name.Name)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+// fuzzyMatch reports whether the characters of query appear in order in
+// cand, ignoring case, and if so how well: matches at the start of cand, at
+// the start of words within it and runs of consecutive matches score
+// higher, as do matches of the same case. Gaps between matches cost
+func fuzzyMatch(query, cand string) (int, bool) {
+	q, c := []rune(query), []rune(cand)
+	if len(q) > len(c) {
+		return 0, false
+	}
+	if strings.EqualFold(query, cand) {
+		score := 100
+		if query == cand {
+			score++
+		}
+		return score, true
+	}
+
+	score, qi, last := 0, 0, -2
+	for ci := 0; ci < len(c) && qi < len(q); ci++ {
+		if unicode.ToLower(c[ci]) != unicode.ToLower(q[qi]) {
+			continue
+		}
+		score++
+		if c[ci] == q[qi] {
+			score++
+		}
+		switch {
+		case ci == 0:
+			score += 8
+		case wordStart(c, ci):
+			score += 5
+		}
+		switch {
+		case last == ci-1:
+			score += 5
+		case last >= 0:
+			score -= 3 * (ci - last - 1)
+		}
+		last = ci
+		qi++
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+	return score, true
+}
+
+// wordStart reports whether the rune at i starts a word in the identifier
+// (or qualified identifier) c: it follows a _ or ., or is an upper case
+// letter following a lower case one
+func wordStart(c []rune, i int) bool {
+	prev := c[i-1]
+	return prev == '_' || prev == '.' || unicode.IsUpper(c[i]) && !unicode.IsUpper(prev)
+}
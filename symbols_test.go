@@ -0,0 +1,86 @@
+package neogo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (t *PluginTest) TestSymbols(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": "package a\n\ntype Frobber struct {\n\tfrobs int\n}\n\nfunc (f *Frobber) Frob() {}\n",
+		"b/b.go": "package b\n\nfunc NewFrobber() {}\n\nconst forb = 1\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+
+	afn := filepath.Join(root, "a", "a.go")
+	bfn := filepath.Join(root, "b", "b.go")
+	t.nvim.setBuffer(afn, "package a")
+
+	// entering a buffer starts the index of its workspace
+	c.Assert(t.plug.BufferEnter(nil, afn), IsNil)
+	t.plug.mu.Lock()
+	idx := t.plug.indexes[root]
+	t.plug.mu.Unlock()
+	c.Assert(idx, NotNil)
+	<-idx.ready
+
+	item := func(fn string, line, col int, text string) string {
+		return vimValue(map[string]interface{}{"filename": fn, "lnum": line, "col": col, "text": text})
+	}
+	lastList := func() string {
+		cmds := t.nvim.recorded("vim_command", "nvim_command")
+		for i := len(cmds) - 1; i >= 0; i-- {
+			if s := cmds[i].Args[0].(string); strings.HasPrefix(s, "call setqflist(") {
+				return s
+			}
+		}
+		return ""
+	}
+
+	c.Assert(t.plug.Symbols(nil, "frob"), IsNil)
+	want := "[" + strings.Join([]string{
+		item(afn, 7, 19, "method a.Frobber.Frob"),
+		item(afn, 4, 2, "field a.Frobber.frobs"),
+		item(afn, 3, 6, "type a.Frobber"),
+		item(bfn, 3, 6, "func b.NewFrobber"),
+	}, ", ") + "]"
+	c.Assert(strings.Contains(lastList(), want), Equals, true, Commentf("%v", lastList()))
+
+	c.Assert(t.plug.Symbols(nil, "b.frob"), IsNil)
+	want = "[" + item(bfn, 3, 6, "func b.NewFrobber") + "]"
+	c.Assert(strings.Contains(lastList(), want), Equals, true, Commentf("%v", lastList()))
+
+	// saving a file updates the index
+	err := ioutil.WriteFile(bfn, []byte("package b\n\nfunc Unfrob() {}\n"), 0644)
+	c.Assert(err, IsNil)
+	c.Assert(t.plug.BufferWrite(nil, bfn), IsNil)
+	c.Assert(t.plug.Symbols(nil, "b.frob"), IsNil)
+	want = "[" + item(bfn, 3, 6, "func b.Unfrob") + "]"
+	c.Assert(strings.Contains(lastList(), want), Equals, true, Commentf("%v", lastList()))
+}
+
+func (t *PluginTest) TestFuzzyMatch(c *C) {
+	for _, tc := range []struct {
+		query, cand string
+		ok          bool
+	}{
+		{"nf", "NewFrobber", true},
+		{"NF", "newfrob", true},
+		{"fn", "NewFrobber", false},
+		{"toolong", "tool", false},
+	} {
+		_, ok := fuzzyMatch(tc.query, tc.cand)
+		c.Check(ok, Equals, tc.ok, Commentf("%q in %q", tc.query, tc.cand))
+	}
+	exact, _ := fuzzyMatch("frob", "Frob")
+	prefix, _ := fuzzyMatch("frob", "Frobber")
+	inner, _ := fuzzyMatch("frob", "NewFrobber")
+	scattered, _ := fuzzyMatch("frob", "fooRob")
+	c.Check(exact > prefix && prefix > inner && inner > scattered, Equals, true,
+		Commentf("%v %v %v %v", exact, prefix, inner, scattered))
+}
@@ -0,0 +1,354 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/myitcv/neovim"
+)
+
+// tagTransforms derive tag values from field names, by the names they go by
+// in g:neogo_tag_transform and :NeogoAddTags
+var tagTransforms = map[string]func(string) string{
+	"snakecase": snakeCase,
+	"camelcase": camelCase,
+}
+
+// AddTags adds the tag keys in args, e.g. "json yaml:camelcase", to the
+// fields of the struct type under the cursor or, given a range (line1 > 0),
+// the fields declared on lines line1 to line2. The value of each is the
+// field's name transformed as key:transform says, or else as
+// g:neogo_tag_transform does. Keys a field already has are left alone, and
+// embedded fields are skipped. The tags are then realigned as gofmt would
+// align them. Exposed as NeogoAddTags and :[range]NeogoAddTags {key}...
+func (n *Neogo) AddTags(o *neovim.MethodOptionParams, line1, line2 int, args string) error {
+	return n.report(n.tags(line1, line2, args, true))
+}
+
+// RemoveTags removes the tag keys in args, or all tags if there are none,
+// from the fields AddTags would add them to. Exposed as NeogoRemoveTags and
+// :[range]NeogoRemoveTags [key]...
+func (n *Neogo) RemoveTags(o *neovim.MethodOptionParams, line1, line2 int, args string) error {
+	return n.report(n.tags(line1, line2, args, false))
+}
+
+// tagPair is a key of a struct tag and its value, quoted
+type tagPair struct {
+	key, value string
+}
+
+func (n *Neogo) tags(line1, line2 int, args string, add bool) error {
+	if err := n.requireFeature(FeatureTags); err != nil {
+		return err
+	}
+	b, err := n.currentBuffer()
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	transforms := make(map[string]func(string) string)
+	for _, a := range strings.Fields(args) {
+		k, t := a, n.config().TagTransform
+		if i := strings.Index(a, ":"); i >= 0 && add {
+			k, t = a[:i], a[i+1:]
+		}
+		if !validTagKey(k) {
+			return fmt.Errorf("%q is not a valid tag key", k)
+		}
+		if transforms[k] = tagTransforms[t]; transforms[k] == nil {
+			return fmt.Errorf("unknown transform %q; want one of %v", t, strings.Join(tagTransformNames(), ", "))
+		}
+		keys = append(keys, k)
+	}
+	if add && keys == nil {
+		return fmt.Errorf("no tag keys given")
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, b.name, b.src(), parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	line := func(p token.Pos) int { return fset.Position(p).Line }
+	fields, structs := taggedFields(f, line, line1, line2, filePos(fset, f, b.offset(b.line, b.col)))
+	if fields == nil {
+		if line1 > 0 {
+			return fmt.Errorf("no struct fields in range")
+		}
+		return fmt.Errorf("no struct type under cursor")
+	}
+
+	// last first, so that the columns of others on the same line hold
+	lines := append([]string(nil), b.lines...)
+	for i := len(fields) - 1; i >= 0; i-- {
+		fld := fields[i]
+		if len(fld.Names) == 0 {
+			continue
+		}
+		var pairs []tagPair
+		if fld.Tag != nil {
+			s, err := strconv.Unquote(fld.Tag.Value)
+			ok := err == nil
+			if ok {
+				pairs, ok = parseTag(s)
+			}
+			if !ok {
+				return fmt.Errorf("field %v has a malformed tag", fld.Names[0].Name)
+			}
+		}
+
+		changed := false
+		if add {
+			if len(fld.Names) > 1 {
+				// one tag would give them all the same key
+				var names []string
+				for _, id := range fld.Names {
+					names = append(names, id.Name)
+				}
+				return fmt.Errorf("fields %v share a tag; declare them separately", strings.Join(names, ", "))
+			}
+			for _, k := range keys {
+				if !hasTag(pairs, k) {
+					pairs = append(pairs, tagPair{key: k, value: strconv.Quote(transforms[k](fld.Names[0].Name))})
+					changed = true
+				}
+			}
+		} else {
+			var kept []tagPair
+			for _, p := range pairs {
+				if keys == nil || contains(keys, p.key) {
+					changed = true
+				} else {
+					kept = append(kept, p)
+				}
+			}
+			pairs = kept
+		}
+		if !changed {
+			continue
+		}
+
+		tag := tagString(pairs)
+		from, to := fset.Position(fld.Type.End()), fset.Position(fld.Type.End())
+		switch {
+		case fld.Tag == nil:
+			tag = " " + tag
+		case pairs == nil:
+			to = fset.Position(fld.Tag.End())
+		default:
+			from, to = fset.Position(fld.Tag.Pos()), fset.Position(fld.Tag.End())
+		}
+		if from.Line != to.Line {
+			continue
+		}
+		l := lines[from.Line-1]
+		lines[from.Line-1] = l[:from.Column-1] + tag + l[to.Column-1:]
+	}
+
+	for _, st := range structs {
+		e := aligned(lines, lineEdit{start: line(st.Pos()) - 1, end: line(st.End()), lines: lines[line(st.Pos())-1 : line(st.End())]})
+		lines = e.apply(lines)
+	}
+	return n.applyEdits(lineDiff(b.lines, lines))
+}
+
+// taggedFields returns the fields of the struct type that contains pos,
+// or, if line1 > 0, the fields of any struct type declared on lines line1
+// to line2, in the order they appear. structs are the struct types to
+// realign: the one that contains pos, or the outermost of those in range
+func taggedFields(f *ast.File, line func(token.Pos) int, line1, line2 int, pos token.Pos) (fields []*ast.Field, structs []*ast.StructType) {
+	if line1 == 0 {
+		for _, nd := range enclosing(f, pos) {
+			var st *ast.StructType
+			switch nd := nd.(type) {
+			case *ast.StructType:
+				st = nd
+			case *ast.TypeSpec:
+				st, _ = nd.Type.(*ast.StructType)
+			case *ast.GenDecl:
+				if nd.Tok == token.TYPE && len(nd.Specs) == 1 {
+					st, _ = nd.Specs[0].(*ast.TypeSpec).Type.(*ast.StructType)
+				}
+			}
+			if st != nil {
+				return st.Fields.List, []*ast.StructType{st}
+			}
+		}
+		return nil, nil
+	}
+
+	var outer *ast.StructType
+	var stack []ast.Node
+	ast.Inspect(f, func(nd ast.Node) bool {
+		if nd == nil {
+			if stack[len(stack)-1] == ast.Node(outer) {
+				outer = nil
+			}
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		stack = append(stack, nd)
+		switch nd := nd.(type) {
+		case *ast.StructType:
+			if outer == nil {
+				outer = nd
+			}
+		case *ast.Field:
+			if outer == nil || line(nd.Pos()) < line1 || line(nd.Pos()) > line2 {
+				break
+			}
+			if _, ok := stack[len(stack)-3].(*ast.StructType); !ok {
+				// a parameter, result or method of a struct's field type
+				break
+			}
+			fields = append(fields, nd)
+			if len(structs) == 0 || structs[len(structs)-1] != outer {
+				structs = append(structs, outer)
+			}
+		}
+		return true
+	})
+	return fields, structs
+}
+
+// parseTag splits tag into its key:"value" pairs as reflect.StructTag
+// reads them, or returns false if it is not in that form
+func parseTag(tag string) ([]tagPair, bool) {
+	var res []tagPair
+	for {
+		tag = strings.TrimLeft(tag, " ")
+		if tag == "" {
+			return res, true
+		}
+		i := 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		if i == 0 || i+1 >= len(tag) || tag[i] != ':' || tag[i+1] != '"' {
+			return nil, false
+		}
+		key := tag[:i]
+		tag = tag[i+1:]
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			return nil, false
+		}
+		if _, err := strconv.Unquote(tag[:i+1]); err != nil {
+			return nil, false
+		}
+		res = append(res, tagPair{key: key, value: tag[:i+1]})
+		tag = tag[i+1:]
+	}
+}
+
+// tagString returns pairs as a tag literal, or "" if there are none
+func tagString(pairs []tagPair) string {
+	if pairs == nil {
+		return ""
+	}
+	var s []string
+	for _, p := range pairs {
+		s = append(s, p.key+":"+p.value)
+	}
+	res := strings.Join(s, " ")
+	if strings.Contains(res, "`") {
+		return strconv.Quote(res)
+	}
+	return "`" + res + "`"
+}
+
+func hasTag(pairs []tagPair, key string) bool {
+	for _, p := range pairs {
+		if p.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// validTagKey reports whether k can be the key of a struct tag
+func validTagKey(k string) bool {
+	for i := 0; i < len(k); i++ {
+		if k[i] <= ' ' || k[i] == ':' || k[i] == '"' || k[i] == 0x7f {
+			return false
+		}
+	}
+	return k != ""
+}
+
+// nameWords splits a Go name into its words: at underscores, before an
+// upper case letter that follows a lower case one or a digit, and before the
+// last of a run of upper case letters followed by a lower case one, so that
+// HTTPServerID is HTTP, Server and ID
+func nameWords(name string) []string {
+	var res []string
+	for _, part := range strings.Split(name, "_") {
+		rs := []rune(part)
+		start := 0
+		for i := 1; i < len(rs); i++ {
+			prev, cur := rs[i-1], rs[i]
+			if unicode.IsUpper(cur) && (unicode.IsLower(prev) || unicode.IsDigit(prev)) ||
+				unicode.IsUpper(prev) && unicode.IsUpper(cur) && i+1 < len(rs) && unicode.IsLower(rs[i+1]) {
+				res = append(res, string(rs[start:i]))
+				start = i
+			}
+		}
+		if start < len(rs) {
+			res = append(res, string(rs[start:]))
+		}
+	}
+	return res
+}
+
+// snakeCase turns HTTPServerID into http_server_id
+func snakeCase(name string) string {
+	ws := nameWords(name)
+	for i, w := range ws {
+		ws[i] = strings.ToLower(w)
+	}
+	return strings.Join(ws, "_")
+}
+
+// camelCase turns HTTPServerID into httpServerID, keeping initialisms
+// after the first word
+func camelCase(name string) string {
+	ws := nameWords(name)
+	for i, w := range ws {
+		rs := []rune(w)
+		switch {
+		case i == 0:
+			rs = []rune(strings.ToLower(w))
+		case strings.ToUpper(w) != w:
+			rs[0] = unicode.ToUpper(rs[0])
+		}
+		ws[i] = string(rs)
+	}
+	return strings.Join(ws, "")
+}
+
+// tagTransformNames returns the names of the transforms, sorted
+func tagTransformNames() []string {
+	var res []string
+	for k := range tagTransforms {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
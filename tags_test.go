@@ -0,0 +1,117 @@
+package neogo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+const tagsTestSrc = `package a
+
+import "io"
+
+type Server struct {
+	io.Reader
+	HTTPServerID string
+	Name         string ` + "`json:\"n,omitempty\"`" + `
+	Inner        struct {
+		UserID int
+	}
+	F func(a int) bool
+}`
+
+func (t *PluginTest) TestTags(c *C) {
+	gopath, root := writeTree(c, map[string]string{
+		"a/a.go": tagsTestSrc + "\n",
+	})
+	defer os.RemoveAll(gopath)
+	t.plug.ldr = testLoader(gopath)
+	afn := filepath.Join(root, "a", "a.go")
+
+	tags := func(add bool, line1, line2 int, args string) (string, error) {
+		t.nvim.setBuffer(afn, tagsTestSrc)
+		t.nvim.setCursor(6, "Reader", 0)
+		var err error
+		if add {
+			err = t.plug.AddTags(nil, line1, line2, args)
+		} else {
+			err = t.plug.RemoveTags(nil, line1, line2, args)
+		}
+		return strings.Join(t.nvim.bufferLines(), "\n"), err
+	}
+
+	// the fields of the struct under the cursor; existing keys stay
+	n := len(t.nvim.recorded("buffer_set_line_slice"))
+	res, err := tags(true, 0, 0, "json yaml:camelcase")
+	c.Assert(err, IsNil)
+	c.Assert(res, Equals, `package a
+
+import "io"
+
+type Server struct {
+	io.Reader
+	HTTPServerID string `+"`json:\"http_server_id\" yaml:\"httpServerID\"`"+`
+	Name         string `+"`json:\"n,omitempty\" yaml:\"name\"`"+`
+	Inner        struct {
+		UserID int
+	} `+"`json:\"inner\" yaml:\"inner\"`"+`
+	F func(a int) bool `+"`json:\"f\" yaml:\"f\"`"+`
+}`)
+	// only the lines that change, 7 to 8 and 11 to 12
+	c.Assert(t.nvim.recorded("buffer_set_line_slice"), HasLen, n+2)
+
+	// a range reaches into nested structs; the tags are realigned
+	res, err = tags(true, 7, 10, "db")
+	c.Assert(err, IsNil)
+	c.Assert(strings.Split(res, "\n")[6:11], DeepEquals, []string{
+		"\tHTTPServerID string `db:\"http_server_id\"`",
+		"\tName         string `json:\"n,omitempty\" db:\"name\"`",
+		"\tInner        struct {",
+		"\t\tUserID int `db:\"user_id\"`",
+		"\t} `db:\"inner\"`",
+	})
+
+	t.nvim.setVar("neogo_tag_transform", "camelcase")
+	c.Assert(t.plug.ReloadConfig(nil), IsNil)
+	res, err = tags(true, 7, 7, "json")
+	c.Assert(err, IsNil)
+	c.Assert(strings.Split(res, "\n")[6], Equals, "\tHTTPServerID string `json:\"httpServerID\"`")
+
+	res, err = tags(false, 0, 0, "json")
+	c.Assert(err, IsNil)
+	c.Assert(strings.Split(res, "\n")[7], Equals, "\tName         string")
+
+	res, err = tags(false, 8, 8, "")
+	c.Assert(err, IsNil)
+	c.Assert(res, Equals, strings.Replace(tagsTestSrc, " `json:\"n,omitempty\"`", "", 1))
+
+	_, err = tags(true, 0, 0, "json:kebab")
+	c.Assert(err, ErrorMatches, `unknown transform "kebab"; want one of camelcase, snakecase`)
+	_, err = tags(true, 1, 3, "json")
+	c.Assert(err, ErrorMatches, "no struct fields in range")
+
+	// fields declared together would share a key, so are not tagged; their
+	// tags can still be removed
+	const shared = "package a\n\ntype P struct {\n\tX, Y int `json:\"x\"`\n}"
+	t.nvim.setBuffer(afn, shared)
+	t.nvim.setCursor(4, "X", 0)
+	c.Assert(t.plug.AddTags(nil, 0, 0, "yaml"), ErrorMatches, "fields X, Y share a tag; declare them separately")
+	c.Assert(strings.Join(t.nvim.bufferLines(), "\n"), Equals, shared)
+	c.Assert(t.plug.RemoveTags(nil, 0, 0, ""), IsNil)
+	c.Assert(t.nvim.bufferLines()[3], Equals, "\tX, Y int")
+}
+
+func (t *PluginTest) TestNameCase(c *C) {
+	for _, tc := range []struct{ name, snake, camel string }{
+		{"Name", "name", "name"},
+		{"HTTPServerID", "http_server_id", "httpServerID"},
+		{"Base64Value", "base64_value", "base64Value"},
+		{"user_name", "user_name", "userName"},
+		{"ID", "id", "id"},
+	} {
+		c.Check(snakeCase(tc.name), Equals, tc.snake, Commentf("%v", tc.name))
+		c.Check(camelCase(tc.name), Equals, tc.camel, Commentf("%v", tc.name))
+	}
+}
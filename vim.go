@@ -0,0 +1,498 @@
+// Copyright 2014 Paul Jolly <paul@myitcv.org.uk>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package neogo
+
+import (
+	"fmt"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tinylib/msgp/msgp"
+)
+
+// vimString quotes s as a Vim single-quoted string literal
+func vimString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// vimValue encodes v as a Vim expression. Supported are strings, ints, bools
+// and slices and string-keyed maps thereof
+func vimValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return vimString(v)
+	case int:
+		return fmt.Sprint(v)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case []string:
+		vs := make([]string, len(v))
+		for i, e := range v {
+			vs[i] = vimString(e)
+		}
+		return "[" + strings.Join(vs, ", ") + "]"
+	case []interface{}:
+		vs := make([]string, len(v))
+		for i, e := range v {
+			vs[i] = vimValue(e)
+		}
+		return "[" + strings.Join(vs, ", ") + "]"
+	case []map[string]interface{}:
+		vs := make([]string, len(v))
+		for i, e := range v {
+			vs[i] = vimValue(e)
+		}
+		return "[" + strings.Join(vs, ", ") + "]"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		vs := make([]string, len(keys))
+		for i, k := range keys {
+			vs[i] = vimString(k) + ": " + vimValue(v[k])
+		}
+		return "{" + strings.Join(vs, ", ") + "}"
+	default:
+		panic(fmt.Errorf("vimValue: type %T not supported", v))
+	}
+}
+
+// bufferState is a snapshot of the current buffer
+type bufferState struct {
+	name  string
+	lines []string
+
+	// the cursor; line and col are 1-based, col is in bytes
+	line, col int
+}
+
+// src returns the contents of the buffer as they would be written to disk
+func (b *bufferState) src() []byte {
+	return []byte(strings.Join(b.lines, "\n") + "\n")
+}
+
+// offset returns the byte offset of the 1-based line and col
+func (b *bufferState) offset(line, col int) int {
+	off := 0
+	for i := 0; i < line-1 && i < len(b.lines); i++ {
+		off += len(b.lines[i]) + 1
+	}
+	return off + col - 1
+}
+
+// currentBuffer returns the name, contents and cursor position of the
+// current buffer
+func (n *Neogo) currentBuffer() (*bufferState, error) {
+	cb, err := n.c.GetCurrentBuffer()
+	if err != nil {
+		return nil, err
+	}
+	bn, err := cb.GetName()
+	if err != nil {
+		return nil, err
+	}
+	if bn == "" {
+		return nil, fmt.Errorf("buffer has no name")
+	}
+	if bn, err = filepath.Abs(bn); err != nil {
+		return nil, err
+	}
+	bc, err := cb.GetLineSlice(0, -1, true, true)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &bufferState{name: bn, lines: bc}
+	res.line, res.col, err = n.cursor()
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// cursor returns the 1-based line and byte column of the cursor
+func (n *Neogo) cursor() (int, int, error) {
+	curI, err := n.c.Eval("[line('.'), col('.')]")
+	if err != nil {
+		return 0, 0, err
+	}
+	cur, ok := curI.([]interface{})
+	if !ok || len(cur) != 2 {
+		return 0, 0, fmt.Errorf("unexpected cursor position %v", curI)
+	}
+	return int(getUint64(cur[0])), int(getUint64(cur[1])), nil
+}
+
+// jumpTo moves the cursor to p, opening its file if it is not the current
+// buffer. The jumplist is updated so that <C-o> returns
+func (n *Neogo) jumpTo(current string, p token.Position) error {
+	if err := n.c.Command("normal! m'"); err != nil {
+		return err
+	}
+	if p.Filename != current {
+		if err := n.edit(p.Filename); err != nil {
+			return err
+		}
+	}
+	return n.c.Command(fmt.Sprintf("call cursor(%v, %v)", p.Line, p.Column))
+}
+
+// edit opens filename in the current window
+func (n *Neogo) edit(filename string) error {
+	return n.c.Command("execute 'edit' fnameescape(" + vimString(filename) + ")")
+}
+
+// echoError shows err to the user
+func (n *Neogo) echoError(err error) {
+	n.errorf("%v", err)
+	n.c.Command("echohl ErrorMsg | echomsg " + vimString("neogo: "+err.Error()) + " | echohl None")
+}
+
+// echo shows msg to the user
+func (n *Neogo) echo(msg string) {
+	n.c.Command("echo " + vimString(msg))
+}
+
+// report is used by commands to tell the user about a failure
+func (n *Neogo) report(err error) error {
+	if err != nil {
+		n.echoError(err)
+	}
+	return err
+}
+
+// requireFeature fails if feature is disabled
+func (n *Neogo) requireFeature(feature string) error {
+	if !n.config().Enabled(feature) {
+		return fmt.Errorf("feature %v is disabled (g:neogo_features)", feature)
+	}
+	return nil
+}
+
+// fnArgs decodes the arguments of a function called from Neovim
+type fnArgs []interface{}
+
+func (a *fnArgs) DecodeMsg(r *msgp.Reader) error {
+	sz, err := r.ReadArrayHeader()
+	if err != nil {
+		return err
+	}
+	*a = make(fnArgs, sz)
+	for i := range *a {
+		if (*a)[i], err = r.ReadIntf(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// str returns argument i as a string; missing arguments are ""
+func (a fnArgs) str(i int) string {
+	if i >= len(a) {
+		return ""
+	}
+	switch v := a[i].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(a[i])
+}
+
+// int returns argument i as an int; missing arguments are 0
+func (a fnArgs) int(i int) int {
+	if i >= len(a) {
+		return 0
+	}
+	if v, ok := toInt(a[i]); ok {
+		return v
+	}
+	v, _ := strconv.Atoi(a.str(i))
+	return v
+}
+
+// qfItem is an entry in the quickfix or location list
+type qfItem struct {
+	pos  token.Position
+	text string
+}
+
+func (q qfItem) vim() map[string]interface{} {
+	return map[string]interface{}{
+		"filename": q.pos.Filename,
+		"lnum":     q.pos.Line,
+		"col":      q.pos.Column,
+		"text":     q.text,
+	}
+}
+
+// setList replaces the quickfix list, or with loc the location list of the
+// current window, with items and opens it
+func (n *Neogo) setList(loc bool, title string, items []qfItem) error {
+	what := listWhat(title, items)
+
+	set, open := "call setqflist([], ' ', "+what+")", "botright cwindow"
+	if loc {
+		set, open = "call setloclist(0, [], ' ', "+what+")", "lwindow"
+	}
+	if err := n.c.Command(set); err != nil {
+		return err
+	}
+	return n.c.Command(open)
+}
+
+// Limits on the size of floating windows
+const (
+	floatMaxWidth  = 80
+	floatMaxHeight = 20
+)
+
+// floatOptions control the floating window shown by float
+type floatOptions struct {
+	filetype string
+
+	// above places the window above the cursor line rather than below
+	above bool
+
+	// closeOn are the events, in the current buffer, that close the window
+	closeOn string
+
+	// highlights are added to the lines shown
+	highlights []Span
+}
+
+// float shows lines in a floating window at the cursor, replacing any window
+// float showed before from the current window
+func (n *Neogo) float(lines []string, o floatOptions) error {
+	width, height := 1, len(lines)
+	for _, l := range lines {
+		if w := utf8.RuneCountInString(l); w > width {
+			width = w
+		}
+	}
+	if width > floatMaxWidth {
+		width = floatMaxWidth
+	}
+	if height > floatMaxHeight {
+		height = floatMaxHeight
+	}
+	cfg := map[string]interface{}{
+		"relative": "cursor",
+		"row":      1,
+		"col":      0,
+		"width":    width,
+		"height":   height,
+		"style":    "minimal",
+		"border":   "single",
+	}
+	if o.above {
+		cfg["row"], cfg["anchor"] = 0, "SW"
+	}
+
+	// the buffer and window are remembered in w: variables of the current
+	// window; g:neogo_* are reserved for configuration. The buffer is wiped
+	// once its window is closed, and the autocmd that closes the window
+	// replaces any left from before, so that showing a float on every
+	// keystroke leaves nothing behind
+	cmds := []string{
+		"if exists('w:neogo_float') | silent! call nvim_win_close(w:neogo_float, v:true) | endif",
+		"let w:neogo_float_buf = nvim_create_buf(v:false, v:true)",
+		"call nvim_buf_set_option(w:neogo_float_buf, 'bufhidden', 'wipe')",
+		"call nvim_buf_set_lines(w:neogo_float_buf, 0, -1, v:true, " + vimValue(lines) + ")",
+		"call nvim_buf_set_option(w:neogo_float_buf, 'filetype', " + vimString(o.filetype) + ")",
+	}
+	for _, h := range o.highlights {
+		cmds = append(cmds, fmt.Sprintf("call nvim_buf_add_highlight(w:neogo_float_buf, -1, %v, %v, %v, %v)",
+			vimString(h.Class), h.Line-1, h.Col-1, h.Col-1+h.Len))
+	}
+	cmds = append(cmds,
+		"let w:neogo_float = nvim_open_win(w:neogo_float_buf, v:false, "+vimValue(cfg)+")",
+		"augroup neogo_float",
+		"augroup END",
+		"execute 'autocmd! neogo_float * <buffer>'",
+		"execute 'autocmd neogo_float "+o.closeOn+" <buffer> ++once silent! call nvim_win_close(' . w:neogo_float . ', v:true)'",
+	)
+	return n.c.Command(strings.Join(cmds, " | "))
+}
+
+// closeFloat closes the window float showed from the current window, if any
+func (n *Neogo) closeFloat() error {
+	return n.c.Command("if exists('w:neogo_float') | silent! call nvim_win_close(w:neogo_float, v:true) | unlet w:neogo_float | endif")
+}
+
+// lineEdit replaces the 0-based lines [start, end) of a buffer with lines;
+// start == end inserts
+type lineEdit struct {
+	start, end int
+	lines      []string
+}
+
+// apply returns a copy of lines with e applied
+func (e lineEdit) apply(lines []string) []string {
+	res := append([]string(nil), lines[:e.start]...)
+	res = append(res, e.lines...)
+	return append(res, lines[e.end:]...)
+}
+
+// applyEdits applies edits, which must not overlap, to the current buffer.
+// They are applied last first so that the line numbers of the others stay
+// valid
+func (n *Neogo) applyEdits(edits []lineEdit) error {
+	cb, err := n.c.GetCurrentBuffer()
+	if err != nil {
+		return err
+	}
+	sorted := append([]lineEdit(nil), edits...)
+	sort.Sort(byStart(sorted))
+	for i := len(sorted) - 1; i >= 0; i-- {
+		e := sorted[i]
+		if err := cb.SetLineSlice(e.start, e.end, true, false, e.lines); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openBuffers returns the numbers of the loaded buffers of Go files, by
+// file name
+func (n *Neogo) openBuffers() (map[string]int, error) {
+	resI, err := n.c.Eval(`map(filter(getbufinfo({'bufloaded': 1}), 'v:val.name =~# ''\.go$'''), '[v:val.bufnr, v:val.name]')`)
+	if err != nil {
+		return nil, err
+	}
+	l, _ := resI.([]interface{})
+	res := make(map[string]int)
+	for _, e := range l {
+		e, ok := e.([]interface{})
+		if !ok || len(e) != 2 {
+			continue
+		}
+		if nr, ok := toInt(e[0]); ok {
+			res[fmt.Sprint(e[1])] = nr
+		}
+	}
+	return res, nil
+}
+
+// bufLines returns the lines of buffer nr
+func (n *Neogo) bufLines(nr int) ([]string, error) {
+	resI, err := n.c.Eval(fmt.Sprintf("getbufline(%v, 1, '$')", nr))
+	if err != nil {
+		return nil, err
+	}
+	l, ok := resI.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected lines of buffer %v: %v", nr, resI)
+	}
+	res := make([]string, len(l))
+	for i, s := range l {
+		res[i] = fmt.Sprint(s)
+	}
+	return res, nil
+}
+
+// buffer returns the name and contents of buffer nr, a loaded Go buffer
+// that need not be current. The cursor is left unset
+func (n *Neogo) buffer(nr int) (*bufferState, error) {
+	bufs, err := n.openBuffers()
+	if err != nil {
+		return nil, err
+	}
+	for name, bnr := range bufs {
+		if bnr != nr {
+			continue
+		}
+		lines, err := n.bufLines(nr)
+		if err != nil {
+			return nil, err
+		}
+		return &bufferState{name: name, lines: lines}, nil
+	}
+	return nil, fmt.Errorf("buffer %v is not a loaded Go buffer", nr)
+}
+
+// editBuffer applies edits, which must not overlap, to buffer nr, which
+// need not be current
+func (n *Neogo) editBuffer(nr int, edits []lineEdit) error {
+	sorted := append([]lineEdit(nil), edits...)
+	sort.Sort(byStart(sorted))
+	for i := len(sorted) - 1; i >= 0; i-- {
+		e := sorted[i]
+		cmd := fmt.Sprintf("call nvim_buf_set_lines(%v, %v, %v, v:true, %v)", nr, e.start, e.end, vimValue(e.lines))
+		if err := n.c.Command(cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// confirm asks the user question, returning whether they said yes
+func (n *Neogo) confirm(question string) (bool, error) {
+	resI, err := n.c.Eval(fmt.Sprintf(`confirm(%v, "&Yes\n&No", 2)`, vimString(question)))
+	if err != nil {
+		return false, err
+	}
+	i, _ := toInt(resI)
+	return i == 1, nil
+}
+
+// pick asks the user to choose one of items, listed under title, returning
+// its index or -1 if they choose none
+func (n *Neogo) pick(title string, items []string) (int, error) {
+	lines := []string{title}
+	for i, it := range items {
+		lines = append(lines, fmt.Sprintf("%v. %v", i+1, it))
+	}
+	resI, err := n.c.Eval("inputlist(" + vimValue(lines) + ")")
+	if err != nil {
+		return -1, err
+	}
+	i, _ := toInt(resI)
+	if i < 1 || i > len(items) {
+		return -1, nil
+	}
+	return i - 1, nil
+}
+
+type byStart []lineEdit
+
+func (b byStart) Len() int           { return len(b) }
+func (b byStart) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byStart) Less(i, j int) bool { return b[i].start < b[j].start }
+
+// listWhat encodes title and items as the {what} argument of setqflist()
+// and setloclist()
+func listWhat(title string, items []qfItem) string {
+	vs := make([]interface{}, len(items))
+	for i, q := range items {
+		vs[i] = q.vim()
+	}
+	return vimValue(map[string]interface{}{"title": title, "items": vs})
+}
+
+// lineText returns the text of the 1-based line in filename, with leading
+// and trailing space removed, for use in quickfix entries
+func (n *Neogo) lineText(cache map[string][]string, filename string, line int) string {
+	lines, ok := cache[filename]
+	if !ok {
+		src, _ := n.ldr.source(filename)
+		lines = strings.Split(string(src), "\n")
+		cache[filename] = lines
+	}
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[line-1])
+}